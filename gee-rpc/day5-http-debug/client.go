@@ -2,13 +2,14 @@ package geerpc
 
 import (
 	"context"
-	"day4-timeout/codec"
+	"day5-http-debug/codec"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"strings"
 	"sync"
 	"time"
 )
@@ -72,6 +73,16 @@ func Dial(network, address string, opts ...*Option) (*Client, error) {
 	return dialTimeout(NewClient, network, address, opts...)
 }
 
+// XDial 根据 rpcAddr 链接到 rpc 服务端，rpcAddr 的格式是 protocol@addr，
+// 比如 tcp@10.0.0.1:9999、unix@/tmp/geerpc.sock
+func XDial(rpcAddr string, opts ...*Option) (*Client, error) {
+	parts := strings.SplitN(rpcAddr, "@", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("rpc client err: wrong format '%s', expect protocol@addr", rpcAddr)
+	}
+	return Dial(parts[0], parts[1], opts...)
+}
+
 // done 把c发送到 Done 里
 func (c *Call) done() {
 	c.Done <- c
@@ -173,6 +184,8 @@ func (c *Client) receive() {
 			call.done()
 		}
 	}
+	// 出错了，通知所有还在等待的 call，不然它们会一直阻塞
+	c.terminateCalls(err)
 }
 
 // NewClient 新建Client实例
@@ -184,13 +197,31 @@ func NewClient(conn net.Conn, opt *Option) (*Client, error) {
 		log.Println("rpc client：codec error：", err)
 		return nil, err
 	}
-	// 与服务器一起发送选项，编码存储 opt
-	if err := json.NewEncoder(conn).Encode(opt); err != nil {
+	if opt.LegacyHandshake {
+		// 与服务器一起发送选项，编码存储 opt
+		if err := json.NewEncoder(conn).Encode(opt); err != nil {
+			log.Println("rpc client: options error: ", err)
+			_ = conn.Close()
+			return nil, err
+		}
+		return newClientCodec(f(conn), opt), nil
+	}
+	// 发送二进制前导，之后按帧收发
+	preamble, err := encodePreamble(opt)
+	if err == nil {
+		_, err = conn.Write(preamble)
+	}
+	if err != nil {
 		log.Println("rpc client: options error: ", err)
 		_ = conn.Close()
 		return nil, err
 	}
-	return newClientCodec(f(conn), opt), nil
+	cc, err := codec.NewFrameCodec(conn, opt.CodecType)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return newClientCodec(cc, opt), nil
 }
 
 // newClientCodec 给客户端的设置和编解码器赋值，创建子协程，接收响应
@@ -272,7 +303,7 @@ func (c *Client) Go(serviceMethod string, args, reply interface{}, done chan *Ca
 
 // Call 是对 Go 的封装，阻塞 call.Done，等待响应返回，是一个同步接口，同时处理超时。
 func (client *Client) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	call := <-client.Go(serviceMethod, args, reply, make(chan *Call, 1)).Done
+	call := client.Go(serviceMethod, args, reply, make(chan *Call, 1))
 	select {
 	case <-ctx.Done():
 		client.removeCall(call.Seq)
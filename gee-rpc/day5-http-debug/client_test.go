@@ -1,7 +1,11 @@
 package geerpc
 
 import (
+	"bufio"
 	"context"
+	"day5-http-debug/codec"
+	"encoding/json"
+	"fmt"
 	"net"
 	"strings"
 	"testing"
@@ -51,7 +55,8 @@ func TestClient_Call(t *testing.T) {
 	time.Sleep(time.Second)
 	t.Run("client timeout", func(t *testing.T) {
 		client, _ := Dial("tcp", addr)
-		ctx, _ := context.WithTimeout(context.Background(), time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
 		var reply int
 		err := client.Call(ctx, "Bar.Timeout", 1, &reply)
 		_assert(err != nil && strings.Contains(err.Error(), ctx.Err().Error()), "expect a timeout error")
@@ -65,3 +70,51 @@ func TestClient_Call(t *testing.T) {
 		_assert(err != nil && strings.Contains(err.Error(), "handle timeout"), "expect a timeout error")
 	})
 }
+
+func TestClient_Codecs(t *testing.T) {
+	t.Parallel()
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	for _, codecType := range []string{codec.GobType, codec.JsonType} {
+		for _, legacy := range []bool{false, true} {
+			name := codecType
+			if legacy {
+				name += " legacy"
+			}
+			t.Run(name, func(t *testing.T) {
+				client, err := Dial("tcp", l.Addr().String(), &Option{CodecType: codecType, LegacyHandshake: legacy})
+				_assert(err == nil, "dial error: %v", err)
+				defer func() { _ = client.Close() }()
+				for i := 0; i < 5; i++ {
+					var reply int
+					err := client.Call(context.Background(), "Foo.Sum", &Args{Num1: i, Num2: i * i}, &reply)
+					_assert(err == nil && reply == i+i*i, "expect %d, got %d, %v", i+i*i, reply, err)
+				}
+				var reply int
+				err = client.Call(context.Background(), "Foo.Missing", &Args{}, &reply)
+				_assert(err != nil && strings.Contains(err.Error(), "can't find method"), "expect a method error, got %v", err)
+				// 出错之后连接还能继续用
+				err = client.Call(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 1}, &reply)
+				_assert(err == nil && reply == 2, "expect 2, got %d, %v", reply, err)
+			})
+		}
+	}
+
+	// 不用 Go 客户端，直接按 JSON 协议收发
+	t.Run("raw json", func(t *testing.T) {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		_assert(err == nil, "dial error: %v", err)
+		defer conn.Close()
+		fmt.Fprintf(conn, `{"MagicNumber": %d, "CodecType": "application/json"}`+"\n", MagicNumber)
+		fmt.Fprint(conn, `{"ServiceMethod": "Foo.Sum", "Seq": 7}`+"\n"+`{"Num1": 1, "Num2": 2}`+"\n")
+		dec := json.NewDecoder(bufio.NewReader(conn))
+		var h codec.Header
+		var reply int
+		_assert(dec.Decode(&h) == nil && dec.Decode(&reply) == nil, "failed to read response")
+		_assert(h.Seq == 7 && h.Error == "" && reply == 3, "unexpected response %+v %d", h, reply)
+	})
+}
@@ -21,8 +21,8 @@ type Codec interface {
 type NewCodecFunc func(closer io.ReadWriteCloser) Codec
 
 const (
-	GobType string = "application/gob"
-	// JsonType string = "application/json"
+	GobType  string = "application/gob"
+	JsonType string = "application/json"
 )
 
 // NewCodecFuncMap 通过 Codec 的 string 得到构造函数
@@ -31,4 +31,5 @@ var NewCodecFuncMap map[string]NewCodecFunc
 func init() {
 	NewCodecFuncMap = make(map[string]NewCodecFunc)
 	NewCodecFuncMap[GobType] = NewGobCodec
+	NewCodecFuncMap[JsonType] = NewJsonCodec
 }
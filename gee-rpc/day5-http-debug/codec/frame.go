@@ -0,0 +1,174 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+)
+
+// MaxFrameSize 一帧最大的长度，防止对方发一个很大的长度把内存耗光
+const MaxFrameSize = 64 << 20
+
+// 二进制协议里编解码器的编号
+const (
+	GobID  byte = 1
+	JsonID byte = 2
+)
+
+var codecIDs = map[string]byte{
+	GobType:  GobID,
+	JsonType: JsonID,
+}
+
+// IDOf 返回编解码器在二进制协议里的编号
+func IDOf(codecType string) (byte, bool) {
+	id, ok := codecIDs[codecType]
+	return id, ok
+}
+
+// TypeOf 根据编号返回编解码器
+func TypeOf(id byte) (string, bool) {
+	for codecType, i := range codecIDs {
+		if i == id {
+			return codecType, true
+		}
+	}
+	return "", false
+}
+
+// 每一帧单独编码，不依赖前面的帧，其他语言只要能处理单个值就行
+var marshalers = map[string]struct {
+	marshal   func(v interface{}) ([]byte, error)
+	unmarshal func(data []byte, v interface{}) error
+}{
+	GobType: {
+		marshal: func(v interface{}) ([]byte, error) {
+			var buf bytes.Buffer
+			err := gob.NewEncoder(&buf).Encode(v)
+			return buf.Bytes(), err
+		},
+		unmarshal: func(data []byte, v interface{}) error {
+			return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+		},
+	},
+	JsonType: {
+		marshal:   json.Marshal,
+		unmarshal: json.Unmarshal,
+	},
+}
+
+// FrameCodec 长度前缀的帧：4 字节大端序的长度，后面是编码后的内容。
+// 每个消息是两帧，先 Header 后 Body，Header.Error 不为空时 Body 是空帧
+type FrameCodec struct {
+	conn      io.ReadWriteCloser
+	r         *bufio.Reader
+	buf       *bufio.Writer
+	marshal   func(v interface{}) ([]byte, error)
+	unmarshal func(data []byte, v interface{}) error
+}
+
+// 强制类型转换，保证 FrameCodec 实现了 Codec
+var _ Codec = (*FrameCodec)(nil)
+
+// NewFrameCodec 用 codecType 编码每一帧的内容
+func NewFrameCodec(conn io.ReadWriteCloser, codecType string) (Codec, error) {
+	m, ok := marshalers[codecType]
+	if !ok {
+		return nil, fmt.Errorf("codec: unsupported frame codec %s", codecType)
+	}
+	return &FrameCodec{
+		conn:      conn,
+		r:         bufio.NewReader(conn),
+		buf:       bufio.NewWriter(conn),
+		marshal:   m.marshal,
+		unmarshal: m.unmarshal,
+	}, nil
+}
+
+// 读出一帧
+func (f *FrameCodec) readFrame() ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(f.r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > MaxFrameSize {
+		return nil, fmt.Errorf("codec: frame too large: %d bytes", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(f.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// 写入一帧，需要 Flush 才会发出去
+func (f *FrameCodec) writeFrame(data []byte) error {
+	if len(data) > MaxFrameSize {
+		return fmt.Errorf("codec: frame too large: %d bytes", len(data))
+	}
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(data)))
+	if _, err := f.buf.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := f.buf.Write(data)
+	return err
+}
+
+// ReadHeader 返回解码之后的 Header
+func (f *FrameCodec) ReadHeader(h *Header) error {
+	data, err := f.readFrame()
+	if err != nil {
+		return err
+	}
+	return f.unmarshal(data, h)
+}
+
+// ReadBody 返回解码之后的 Body，i 为 nil 时整帧丢掉
+func (f *FrameCodec) ReadBody(i interface{}) error {
+	data, err := f.readFrame()
+	if err != nil || i == nil {
+		return err
+	}
+	return f.unmarshal(data, i)
+}
+
+// Writer 把 Header 和 Body 各写成一帧
+func (f *FrameCodec) Writer(h *Header, i interface{}) (err error) {
+	defer func() {
+		_ = f.buf.Flush()
+		if err != nil {
+			_ = f.Close()
+		}
+	}()
+	header, err := f.marshal(h)
+	if err != nil {
+		log.Println("rpc: frame error encoding header:", err)
+		return
+	}
+	var body []byte
+	if h.Error == "" {
+		if body, err = f.marshal(i); err != nil {
+			log.Println("rpc: frame error encoding body:", err)
+			return
+		}
+	}
+	if err = f.writeFrame(header); err != nil {
+		return
+	}
+	return f.writeFrame(body)
+}
+
+// Close 关闭 io 链接
+func (f *FrameCodec) Close() error {
+	return f.conn.Close()
+}
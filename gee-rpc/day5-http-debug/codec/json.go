@@ -0,0 +1,68 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+)
+
+// JsonCodec 用 JSON 编解码，Header 和 Body 各是一个 JSON 值，方便其他语言的客户端接入
+type JsonCodec struct {
+	conn io.ReadWriteCloser // 构建函数传入，建立 socket 获取到的链接实例
+	buf  *bufio.Writer      // 带缓冲的 Writer，Header 和 Body 写完再一起发出去
+	dec  *json.Decoder      // 从连接里一个一个读出 JSON 值
+	enc  *json.Encoder      // 每个值后面带一个换行
+}
+
+// 强制类型转换，保证 JsonCodec 实现了 Codec
+var _ Codec = (*JsonCodec)(nil)
+
+// NewJsonCodec 初始化
+func NewJsonCodec(conn io.ReadWriteCloser) Codec {
+	buf := bufio.NewWriter(conn)
+	return &JsonCodec{
+		conn: conn,
+		buf:  buf,
+		dec:  json.NewDecoder(conn),
+		enc:  json.NewEncoder(buf),
+	}
+}
+
+// ReadHeader 返回解码之后的 Header
+func (j *JsonCodec) ReadHeader(h *Header) error {
+	return j.dec.Decode(h)
+}
+
+// ReadBody 返回解码之后的 Body，i 为 nil 时读出来丢掉，保证下一个值从 Header 开始
+func (j *JsonCodec) ReadBody(i interface{}) error {
+	if i == nil {
+		var discard json.RawMessage
+		return j.dec.Decode(&discard)
+	}
+	return j.dec.Decode(i)
+}
+
+// Writer 写入序列化之后的 Header 和 Body
+func (j *JsonCodec) Writer(h *Header, i interface{}) (err error) {
+	defer func() {
+		_ = j.buf.Flush()
+		if err != nil {
+			_ = j.Close()
+		}
+	}()
+	if err = j.enc.Encode(h); err != nil {
+		log.Println("rpc: json error encoding header:", err)
+		return
+	}
+	if err = j.enc.Encode(i); err != nil {
+		log.Println("rpc: json error encoding body:", err)
+		return
+	}
+	return
+}
+
+// Close 关闭 io 链接
+func (j *JsonCodec) Close() error {
+	return j.conn.Close()
+}
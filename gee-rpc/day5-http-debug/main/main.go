@@ -1,7 +1,8 @@
 package main
 
 import (
-	geerpc "day4-timeout"
+	"context"
+	geerpc "day5-http-debug"
 	"log"
 	"net"
 	"sync"
@@ -49,7 +50,7 @@ func main() {
 			defer wg.Done()
 			args := &Args{Num1: i, Num2: i * i}
 			var reply int
-			if err := client.Call("Foo.Sum", args, &reply); err != nil {
+			if err := client.Call(context.Background(), "Foo.Sum", args, &reply); err != nil {
 				log.Fatal("call Foo.Sum error:", err)
 			}
 			log.Printf("%d + %d = %d", args.Num1, args.Num2, reply)
@@ -0,0 +1,65 @@
+package geerpc
+
+import (
+	"day5-http-debug/codec"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ProtocolVersion 二进制协议的版本
+const ProtocolVersion = 1
+
+// preambleSize 连接建立后客户端先发送固定 16 字节的前导，所有整数都是大端序：
+//
+//	0  4  MagicNumber
+//	4  1  协议版本
+//	5  1  编解码器编号，见 codec.IDOf
+//	6  2  flags，目前没有定义，必须是 0
+//	8  8  HandleTimeout，单位纳秒，0 表示不限制
+//
+// 之后每个请求和响应都是两个长度前缀的帧，见 codec.FrameCodec。
+// 旧版客户端发送的是 JSON 格式的 Option，第一个字节是 {，服务端两种都支持
+const preambleSize = 16
+
+// 把 Option 编码成前导
+func encodePreamble(opt *Option) ([]byte, error) {
+	id, ok := codec.IDOf(opt.CodecType)
+	if !ok {
+		return nil, fmt.Errorf("rpc: codec %s has no protocol id", opt.CodecType)
+	}
+	buf := make([]byte, preambleSize)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(opt.MagicNumber))
+	buf[4] = ProtocolVersion
+	buf[5] = id
+	binary.BigEndian.PutUint64(buf[8:16], uint64(opt.HandleTimeout))
+	return buf, nil
+}
+
+// 读出前导，还原成 Option
+func readPreamble(r io.Reader) (*Option, error) {
+	buf := make([]byte, preambleSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	if magic := binary.BigEndian.Uint32(buf[0:4]); magic != MagicNumber {
+		return nil, fmt.Errorf("invalid magic number %x", magic)
+	}
+	if buf[4] != ProtocolVersion {
+		return nil, fmt.Errorf("unsupported protocol version %d", buf[4])
+	}
+	codecType, ok := codec.TypeOf(buf[5])
+	if !ok {
+		return nil, fmt.Errorf("invalid codec id %d", buf[5])
+	}
+	if flags := binary.BigEndian.Uint16(buf[6:8]); flags != 0 {
+		return nil, errors.New("unsupported flags")
+	}
+	return &Option{
+		MagicNumber:   MagicNumber,
+		CodecType:     codecType,
+		HandleTimeout: time.Duration(binary.BigEndian.Uint64(buf[8:16])),
+	}, nil
+}
@@ -0,0 +1,88 @@
+package geerpc
+
+import (
+	"bytes"
+	"day5-http-debug/codec"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPreamble(t *testing.T) {
+	buf, err := encodePreamble(&Option{MagicNumber: MagicNumber, CodecType: codec.JsonType, HandleTimeout: time.Second})
+	_assert(err == nil && len(buf) == preambleSize, "encode preamble: %v", err)
+	opt, err := readPreamble(bytes.NewReader(buf))
+	_assert(err == nil && opt.CodecType == codec.JsonType && opt.HandleTimeout == time.Second, "decode preamble: %+v, %v", opt, err)
+
+	bad := append([]byte(nil), buf...)
+	bad[4] = 9
+	_, err = readPreamble(bytes.NewReader(bad))
+	_assert(err != nil, "expect an error for unknown version")
+}
+
+// 不用 Go 客户端，按文档里的二进制协议收发，其他语言也是这么实现
+func TestFrameProtocol(t *testing.T) {
+	server := NewServer()
+	var foo Foo
+	_ = server.Register(&foo)
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	defer conn.Close()
+	preamble := make([]byte, preambleSize)
+	binary.BigEndian.PutUint32(preamble, MagicNumber)
+	preamble[4], preamble[5] = ProtocolVersion, codec.JsonID
+	writeFrame := func(v string) {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(v)))
+		conn.Write(append(size[:], v...))
+	}
+	readFrame := func() []byte {
+		var size [4]byte
+		_, err := io.ReadFull(conn, size[:])
+		_assert(err == nil, "read frame: %v", err)
+		data := make([]byte, binary.BigEndian.Uint32(size[:]))
+		_, err = io.ReadFull(conn, data)
+		_assert(err == nil, "read frame: %v", err)
+		return data
+	}
+	conn.Write(preamble)
+	writeFrame(`{"ServiceMethod": "Foo.Sum", "Seq": 3}`)
+	writeFrame(`{"Num1": 4, "Num2": 5}`)
+	writeFrame(`{"ServiceMethod": "Foo.Nope", "Seq": 4}`)
+	writeFrame(`{}`)
+
+	// 请求是并发处理的，响应的顺序不固定，按 Seq 区分
+	for i := 0; i < 2; i++ {
+		var h codec.Header
+		_assert(json.Unmarshal(readFrame(), &h) == nil, "decode header")
+		body := readFrame()
+		switch h.Seq {
+		case 3:
+			var reply int
+			_assert(h.Error == "" && json.Unmarshal(body, &reply) == nil && reply == 9, "unexpected response %+v %s", h, body)
+		case 4:
+			_assert(h.Error != "" && len(body) == 0, "error responses have an empty body frame, got %+v %s", h, body)
+		default:
+			_assert(false, "unexpected seq %d", h.Seq)
+		}
+	}
+}
+
+func TestFrameProtocol_BadPreamble(t *testing.T) {
+	server := NewServer()
+	l, _ := net.Listen("tcp", ":0")
+	go server.Accept(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	_assert(err == nil, "dial error: %v", err)
+	defer conn.Close()
+	conn.Write(make([]byte, preambleSize))
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	_assert(err == io.EOF, "expect the server to close the connection, got %v", err)
+}
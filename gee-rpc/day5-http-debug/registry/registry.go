@@ -0,0 +1,206 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registry 简单的注册中心，服务端注册自己的地址并定时发送心跳，
+// 超过 timeout 没有心跳的服务端会被移除，客户端通过 GET 拿到所有可用的服务端
+type Registry struct {
+	timeout time.Duration // 为 0 时不过期
+	mu      sync.Mutex
+	servers map[string]*ServerItem
+}
+
+// ServerItem 注册的服务端
+type ServerItem struct {
+	Addr  string
+	start time.Time // 最后一次心跳的时间
+}
+
+const (
+	defaultPath    = "/_geerpc_/registry"
+	defaultTimeout = time.Minute * 5
+)
+
+// client 访问注册中心用的 http.Client，注册中心没有响应时请求也会超时返回，
+// 停止心跳的时候不会一直卡住
+var client = &http.Client{Timeout: time.Second * 10}
+
+// 请求头，GET 时返回逗号分隔的服务端地址，POST 和 DELETE 时是服务端自己的地址
+const (
+	serversHeader = "X-Geerpc-Servers"
+	serverHeader  = "X-Geerpc-Server"
+)
+
+// New 创建注册中心，timeout 是心跳的超时时间
+func New(timeout time.Duration) *Registry {
+	return &Registry{
+		servers: make(map[string]*ServerItem),
+		timeout: timeout,
+	}
+}
+
+// DefaultRegister 默认的注册中心
+var DefaultRegister = New(defaultTimeout)
+
+// putServer 添加服务端，已经存在时更新心跳时间
+func (r *Registry) putServer(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.servers[addr]
+	if s == nil {
+		r.servers[addr] = &ServerItem{Addr: addr, start: time.Now()}
+	} else {
+		s.start = time.Now()
+	}
+}
+
+// removeServer 服务端下线时主动移除
+func (r *Registry) removeServer(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.servers, addr)
+}
+
+// aliveServers 返回可用的服务端，顺便删除过期的
+func (r *Registry) aliveServers() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var alive []string
+	for addr, s := range r.servers {
+		if r.timeout == 0 || s.start.Add(r.timeout).After(time.Now()) {
+			alive = append(alive, addr)
+		} else {
+			delete(r.servers, addr)
+		}
+	}
+	sort.Strings(alive)
+	return alive
+}
+
+// ServeHTTP GET 返回可用的服务端，地址放在 X-Geerpc-Servers 里，响应体是 JSON 数组；
+// POST 注册或者发送心跳，DELETE 注销，地址都放在 X-Geerpc-Server 里
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		alive := r.aliveServers()
+		w.Header().Set(serversHeader, strings.Join(alive, ","))
+		w.Header().Set("Content-Type", "application/json")
+		if alive == nil {
+			alive = []string{}
+		}
+		_ = json.NewEncoder(w).Encode(alive)
+	case http.MethodPost, http.MethodDelete:
+		addr := req.Header.Get(serverHeader)
+		if addr == "" {
+			http.Error(w, "missing "+serverHeader, http.StatusBadRequest)
+			return
+		}
+		if req.Method == http.MethodPost {
+			r.putServer(addr)
+		} else {
+			r.removeServer(addr)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleHTTP 在 registryPath 上注册 HTTP 处理
+func (r *Registry) HandleHTTP(registryPath string) {
+	http.Handle(registryPath, r)
+	log.Println("rpc registry path:", registryPath)
+}
+
+// HandleHTTP 在默认路径上注册默认的注册中心
+func HandleHTTP() {
+	DefaultRegister.HandleHTTP(defaultPath)
+}
+
+// Heartbeat 马上注册 addr，之后每隔 duration 发送一次心跳，返回的函数用来停止心跳并注销。
+// duration 为 0 时比默认的超时时间少一分钟，保证在过期之前发送
+func Heartbeat(registry, addr string, duration time.Duration) (stop func()) {
+	if duration == 0 {
+		duration = defaultTimeout - time.Minute
+	}
+	_ = sendHeartbeat(registry, addr)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(duration)
+		defer t.Stop()
+		// 心跳失败也继续发，注册中心重启之后能重新注册上
+		for {
+			select {
+			case <-t.C:
+				_ = sendHeartbeat(registry, addr)
+			case <-done:
+				_ = send(http.MethodDelete, registry, addr)
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// sendHeartbeat 发送心跳
+func sendHeartbeat(registry, addr string) error {
+	if err := send(http.MethodPost, registry, addr); err != nil {
+		log.Println("rpc server: heart beat err:", err)
+		return err
+	}
+	return nil
+}
+
+func send(method, registry, addr string) error {
+	req, _ := http.NewRequest(method, registry, nil)
+	req.Header.Set(serverHeader, addr)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Servers 从注册中心拿到所有可用的服务端
+func Servers(registry string) ([]string, error) {
+	resp, err := client.Get(registry)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("rpc registry: " + resp.Status)
+	}
+	header := resp.Header.Get(serversHeader)
+	if header == "" {
+		return nil, nil
+	}
+	var servers []string
+	for _, addr := range strings.Split(header, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			servers = append(servers, addr)
+		}
+	}
+	return servers, nil
+}
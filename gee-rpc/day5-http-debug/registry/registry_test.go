@@ -0,0 +1,67 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r := New(200 * time.Millisecond)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	stop := Heartbeat(ts.URL, "tcp@127.0.0.1:9001", 50*time.Millisecond)
+	stopB := Heartbeat(ts.URL, "tcp@127.0.0.1:9002", time.Hour)
+	defer stopB()
+	servers, err := Servers(ts.URL)
+	if err != nil || !reflect.DeepEqual(servers, []string{"tcp@127.0.0.1:9001", "tcp@127.0.0.1:9002"}) {
+		t.Fatalf("expect both servers, got %v, %v", servers, err)
+	}
+
+	// 9002 只注册了一次，超时后被移除；9001 一直有心跳
+	time.Sleep(300 * time.Millisecond)
+	if servers, _ = Servers(ts.URL); !reflect.DeepEqual(servers, []string{"tcp@127.0.0.1:9001"}) {
+		t.Fatalf("expect stale server to expire, got %v", servers)
+	}
+
+	// 停止心跳时注销
+	stop()
+	if servers, _ = Servers(ts.URL); len(servers) != 0 {
+		t.Fatalf("expect no servers after deregistering, got %v", servers)
+	}
+}
+
+func TestRegistry_BadRequest(t *testing.T) {
+	ts := httptest.NewServer(New(time.Minute))
+	defer ts.Close()
+	resp, err := http.Post(ts.URL, "text/plain", nil)
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expect 400 without server address, got %v, %v", resp, err)
+	}
+	resp.Body.Close()
+}
+
+func TestHeartbeat_RegistryHangs(t *testing.T) {
+	old := client
+	client = &http.Client{Timeout: 50 * time.Millisecond}
+	defer func() { client = old }()
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	start := time.Now()
+	stop := Heartbeat(ts.URL, "tcp@127.0.0.1:9001", time.Hour)
+	stop()
+	if _, err := Servers(ts.URL); err == nil {
+		t.Fatal("expect timeout error from a hanging registry")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expect requests to time out, took %s", d)
+	}
+}
@@ -1,7 +1,8 @@
 package geerpc
 
 import (
-	"day4-timeout/codec"
+	"bufio"
+	"day5-http-debug/codec"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -22,6 +23,8 @@ type Option struct {
 	CodecType      string        // 客户可以选择不同的编解码器来编码主体
 	ConnectTimeout time.Duration // 连接超时
 	HandleTimeout  time.Duration // 处理超时
+	// LegacyHandshake 用旧的 JSON Option 握手和流式编解码，连接还没有升级的服务端时使用
+	LegacyHandshake bool
 }
 
 // DefaultOption 默认的编解码方式，为了简单使用固定的 JSON 编码格式
@@ -80,12 +83,40 @@ func (server *Server) Accept(lis net.Listener) {
 	}
 }
 
-// ServeConn 在单个链接上运行并且一直阻塞提供服务，直到客户端挂断
+// ServeConn 在单个链接上运行并且一直阻塞提供服务，直到客户端挂断。
+// 第一个字节是 { 时是旧版客户端的 JSON Option，否则是二进制前导
 func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	first, err := r.Peek(1)
+	if err != nil {
+		return
+	}
+	// 之后从 r 读，前面已经读进缓冲的数据不会丢
+	conn = &bufferedConn{Reader: r, ReadWriteCloser: conn}
+	if first[0] == '{' {
+		server.serveLegacy(conn)
+		return
+	}
+	opt, err := readPreamble(r)
+	if err != nil {
+		log.Println("rpc server: preamble error:", err)
+		return
+	}
+	cc, err := codec.NewFrameCodec(conn, opt.CodecType)
+	if err != nil {
+		log.Println("rpc server:", err)
+		return
+	}
+	server.serveCodec(cc, opt)
+}
+
+// serveLegacy 兼容旧版客户端：JSON 格式的 Option，之后是流式编解码
+func (server *Server) serveLegacy(conn io.ReadWriteCloser) {
 	var opt Option
 	// 反序列化得到 Option 实例
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil {
+	dec := json.NewDecoder(conn)
+	if err := dec.Decode(&opt); err != nil {
 		log.Println("rpc server: options error: ", err)
 		return
 	}
@@ -100,7 +131,23 @@ func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 		return
 	}
 	// 根据 CodeType 得到对应的消息编解码器
-	server.serveCodec(f(conn), &opt)
+	// 解码 Option 时可能多读了后面的请求，先从 dec 的缓冲里读。
+	// json.Encoder 在 Option 后面写了一个换行，只去掉这一个字节，后面的数据原样交给编解码器
+	r := bufio.NewReader(io.MultiReader(dec.Buffered(), conn))
+	if b, err := r.Peek(1); err == nil && b[0] == '\n' {
+		_, _ = r.Discard(1)
+	}
+	server.serveCodec(f(&bufferedConn{Reader: r, ReadWriteCloser: conn}), &opt)
+}
+
+// bufferedConn 读的时候先读 Reader，写和关闭还是用原来的连接
+type bufferedConn struct {
+	io.Reader
+	io.ReadWriteCloser
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.Reader.Read(p)
 }
 
 // invalidRequest 是一个占位符
@@ -150,6 +197,8 @@ func (server *Server) readRequest(cc codec.Codec) (*request, error) {
 	req := &request{h: h}
 	req.svc, req.mtype, err = server.findService(h.ServiceMethod)
 	if err != nil {
+		// 请求体也要读掉，不然会被当成下一个请求头
+		_ = cc.ReadBody(nil)
 		return req, err
 	}
 	// 创建两个入参实例
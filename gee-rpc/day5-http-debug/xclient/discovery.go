@@ -0,0 +1,169 @@
+package xclient
+
+import (
+	"errors"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SelectMode 负载均衡的策略
+type SelectMode int
+
+const (
+	RandomSelect         SelectMode = iota // 随机选择
+	RoundRobinSelect                       // 轮询
+	WeightedSelect                         // 按权重平滑轮询，权重用 SetWeight 设置，默认 1
+	ConsistentHashSelect                   // 一致性哈希，同一个 key 总是落到同一个服务端
+)
+
+// ErrNoServers 没有可用的服务端
+var ErrNoServers = errors.New("rpc discovery: no available servers")
+
+// Discovery 服务发现
+type Discovery interface {
+	Refresh() error                      // 从注册中心更新服务列表
+	Update(servers []string) error       // 手动更新服务列表
+	Get(mode SelectMode) (string, error) // 根据负载均衡策略选择一个服务端
+	GetAll() ([]string, error)           // 返回所有的服务端
+}
+
+// KeyedDiscovery 支持一致性哈希的服务发现，XClient 用 ConsistentHashSelect 时需要
+type KeyedDiscovery interface {
+	Discovery
+	GetByKey(key string) (string, error) // 根据 key 选择服务端
+}
+
+// defaultReplicas 一致性哈希每个服务端的虚拟节点数
+const defaultReplicas = 50
+
+// MultiServersDiscovery 不需要注册中心，服务列表由用户手动维护
+type MultiServersDiscovery struct {
+	r       *rand.Rand // 生成随机数
+	mu      sync.Mutex
+	servers []string
+	index   int // 轮询到的位置
+
+	weights map[string]int // 服务端的权重
+	current map[string]int // 平滑加权轮询当前的权重
+
+	ring  []uint32          // 一致性哈希环，排好序的虚拟节点
+	nodes map[uint32]string // 虚拟节点对应的服务端
+}
+
+var _ KeyedDiscovery = (*MultiServersDiscovery)(nil)
+
+// NewMultiServerDiscovery 创建 MultiServersDiscovery
+func NewMultiServerDiscovery(servers []string) *MultiServersDiscovery {
+	d := &MultiServersDiscovery{
+		r:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		weights: make(map[string]int),
+	}
+	// 从随机的位置开始轮询，避免每次都从 0 开始
+	d.index = d.r.Intn(1 << 30)
+	d.setServers(servers)
+	return d
+}
+
+// Refresh 没有注册中心，什么都不做
+func (d *MultiServersDiscovery) Refresh() error {
+	return nil
+}
+
+// Update 更新服务列表
+func (d *MultiServersDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.setServers(servers)
+	return nil
+}
+
+// SetWeight 设置服务端的权重，WeightedSelect 时使用，小于 1 时按 1 算
+func (d *MultiServersDiscovery) SetWeight(server string, weight int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.weights[server] = weight
+}
+
+// Get 根据负载均衡策略选择一个服务端
+func (d *MultiServersDiscovery) Get(mode SelectMode) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := len(d.servers)
+	if n == 0 {
+		return "", ErrNoServers
+	}
+	switch mode {
+	case RandomSelect:
+		return d.servers[d.r.Intn(n)], nil
+	case RoundRobinSelect:
+		s := d.servers[d.index%n]
+		d.index = (d.index + 1) % n
+		return s, nil
+	case WeightedSelect:
+		return d.weighted(), nil
+	case ConsistentHashSelect:
+		return "", errors.New("rpc discovery: consistent hash needs a key, use GetByKey")
+	default:
+		return "", errors.New("rpc discovery: not supported select mode")
+	}
+}
+
+// GetByKey 一致性哈希，返回环上 key 之后的第一个虚拟节点对应的服务端
+func (d *MultiServersDiscovery) GetByKey(key string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.ring) == 0 {
+		return "", ErrNoServers
+	}
+	hash := crc32.ChecksumIEEE([]byte(key))
+	idx := sort.Search(len(d.ring), func(i int) bool { return d.ring[i] >= hash })
+	return d.nodes[d.ring[idx%len(d.ring)]], nil
+}
+
+// GetAll 返回所有服务端的拷贝
+func (d *MultiServersDiscovery) GetAll() ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	servers := make([]string, len(d.servers))
+	copy(servers, d.servers)
+	return servers, nil
+}
+
+// setServers 替换服务列表并重建哈希环，需要持有锁
+func (d *MultiServersDiscovery) setServers(servers []string) {
+	d.servers = append([]string(nil), servers...)
+	d.current = make(map[string]int, len(servers))
+	d.ring = d.ring[:0]
+	d.nodes = make(map[uint32]string, len(servers)*defaultReplicas)
+	for _, s := range d.servers {
+		for i := 0; i < defaultReplicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + s))
+			d.ring = append(d.ring, hash)
+			d.nodes[hash] = s
+		}
+	}
+	sort.Slice(d.ring, func(i, j int) bool { return d.ring[i] < d.ring[j] })
+}
+
+// weighted 平滑加权轮询：每次所有服务端加上自己的权重，选当前权重最大的，
+// 选中的减去总权重。权重 5:1:1 时选择的顺序是 a a b a c a a，不会连续打到同一个服务端
+func (d *MultiServersDiscovery) weighted() string {
+	total, best := 0, ""
+	for _, s := range d.servers {
+		w := d.weights[s]
+		if w < 1 {
+			w = 1
+		}
+		total += w
+		d.current[s] += w
+		if best == "" || d.current[s] > d.current[best] {
+			best = s
+		}
+	}
+	d.current[best] -= total
+	return best
+}
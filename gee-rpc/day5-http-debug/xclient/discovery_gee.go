@@ -0,0 +1,113 @@
+package xclient
+
+import (
+	"day5-http-debug/registry"
+	"log"
+	"sync"
+	"time"
+)
+
+// GeeRegistryDiscovery 从注册中心获取服务列表，超过 timeout 之后重新获取
+type GeeRegistryDiscovery struct {
+	*MultiServersDiscovery
+	registry   string        // 注册中心的地址
+	timeout    time.Duration // 服务列表的过期时间
+	mu         sync.Mutex    // 保护 lastUpdate 和 retryAt
+	lastUpdate time.Time     // 最后从注册中心更新服务列表的时间
+	retryAt    time.Time     // 上次获取失败之后，到这个时间之前不再请求注册中心
+	refreshMu  sync.Mutex    // 同一时间只有一个 goroutine 请求注册中心
+}
+
+var _ KeyedDiscovery = (*GeeRegistryDiscovery)(nil)
+
+const (
+	defaultUpdateTimeout = time.Second * 10
+	defaultRetryInterval = time.Second // 从注册中心获取失败之后的重试间隔
+)
+
+// NewGeeRegistryDiscovery 创建 GeeRegistryDiscovery，timeout 为 0 时默认 10s
+func NewGeeRegistryDiscovery(registerAddr string, timeout time.Duration) *GeeRegistryDiscovery {
+	if timeout == 0 {
+		timeout = defaultUpdateTimeout
+	}
+	return &GeeRegistryDiscovery{
+		MultiServersDiscovery: NewMultiServerDiscovery(nil),
+		registry:              registerAddr,
+		timeout:               timeout,
+	}
+}
+
+// Update 更新服务列表
+func (d *GeeRegistryDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastUpdate = time.Now()
+	return d.MultiServersDiscovery.Update(servers)
+}
+
+// Refresh 服务列表过期之后从注册中心重新获取。
+// 获取失败时如果有旧的服务列表就继续用，隔 defaultRetryInterval 之后再试
+func (d *GeeRegistryDiscovery) Refresh() error {
+	if d.fresh() {
+		return nil
+	}
+	cached, _ := d.MultiServersDiscovery.GetAll()
+	if len(cached) > 0 {
+		// 有旧的服务列表时不用等别的 goroutine 刷新完
+		if !d.refreshMu.TryLock() {
+			return nil
+		}
+	} else {
+		d.refreshMu.Lock()
+	}
+	defer d.refreshMu.Unlock()
+	// 等锁的时候可能已经被别的 goroutine 刷新了
+	if d.fresh() {
+		return nil
+	}
+	log.Println("rpc registry: refresh servers from registry", d.registry)
+	servers, err := registry.Servers(d.registry)
+	if err != nil {
+		log.Println("rpc registry refresh err:", err)
+		d.mu.Lock()
+		d.retryAt = time.Now().Add(defaultRetryInterval)
+		d.mu.Unlock()
+		if len(cached) > 0 {
+			return nil
+		}
+		return err
+	}
+	return d.Update(servers)
+}
+
+// fresh 服务列表没有过期，或者还没到重试的时间
+func (d *GeeRegistryDiscovery) fresh() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	return d.lastUpdate.Add(d.timeout).After(now) || d.retryAt.After(now)
+}
+
+// Get 先刷新再选择服务端
+func (d *GeeRegistryDiscovery) Get(mode SelectMode) (string, error) {
+	if err := d.Refresh(); err != nil {
+		return "", err
+	}
+	return d.MultiServersDiscovery.Get(mode)
+}
+
+// GetByKey 先刷新再按 key 选择服务端
+func (d *GeeRegistryDiscovery) GetByKey(key string) (string, error) {
+	if err := d.Refresh(); err != nil {
+		return "", err
+	}
+	return d.MultiServersDiscovery.GetByKey(key)
+}
+
+// GetAll 先刷新再返回所有服务端
+func (d *GeeRegistryDiscovery) GetAll() ([]string, error) {
+	if err := d.Refresh(); err != nil {
+		return nil, err
+	}
+	return d.MultiServersDiscovery.GetAll()
+}
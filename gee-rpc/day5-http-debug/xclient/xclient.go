@@ -0,0 +1,257 @@
+package xclient
+
+import (
+	"context"
+	geerpc "day5-http-debug"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// FailMode 调用失败之后怎么处理
+type FailMode int
+
+const (
+	FailFast FailMode = iota // 直接返回错误
+	FailOver                 // 换下一个服务端重试
+	FailTry                  // 在同一个服务端上退避重试
+)
+
+const (
+	defaultRetries = 3
+	defaultBackoff = time.Millisecond * 100
+)
+
+// XClient 支持负载均衡的客户端，每个服务端复用一个 Client
+type XClient struct {
+	d        Discovery
+	mode     SelectMode
+	opt      *geerpc.Option
+	failMu   sync.Mutex // 保护 failMode、retries 和 backoff
+	failMode FailMode
+	retries  int           // 失败之后最多重试几次
+	backoff  time.Duration // FailTry 第一次重试前等待的时间，之后每次翻倍
+	mu       sync.Mutex    // 保护 clients
+	clients  map[string]*geerpc.Client
+}
+
+var _ io.Closer = (*XClient)(nil)
+
+// NewXClient 创建 XClient，opt 为 nil 时使用默认的 Option
+func NewXClient(d Discovery, mode SelectMode, opt *geerpc.Option) *XClient {
+	return &XClient{
+		d:       d,
+		mode:    mode,
+		opt:     opt,
+		retries: defaultRetries,
+		backoff: defaultBackoff,
+		clients: make(map[string]*geerpc.Client),
+	}
+}
+
+// SetFailMode 设置失败之后的处理方式，默认 FailFast。
+// retries 是最多重试的次数，backoff 是 FailTry 第一次重试前等待的时间，为 0 时使用默认值。
+// 服务端返回的错误也会重试，不是幂等的方法不要用 FailOver 和 FailTry。
+// 可以和 Call 并发调用，只影响之后开始的调用
+func (xc *XClient) SetFailMode(mode FailMode, retries int, backoff time.Duration) {
+	xc.failMu.Lock()
+	defer xc.failMu.Unlock()
+	xc.failMode = mode
+	if retries > 0 {
+		xc.retries = retries
+	}
+	if backoff > 0 {
+		xc.backoff = backoff
+	}
+}
+
+// Close 关闭所有缓存的 Client
+func (xc *XClient) Close() error {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	for key, client := range xc.clients {
+		// 这里不需要处理错误
+		_ = client.Close()
+		delete(xc.clients, key)
+	}
+	return nil
+}
+
+// dial 返回 rpcAddr 对应的 Client，缓存的 Client 不可用时关闭并重新连接。
+// 连接在锁外面进行，一个连不上的服务端不会挡住其他服务端的调用
+func (xc *XClient) dial(rpcAddr string) (*geerpc.Client, error) {
+	xc.mu.Lock()
+	client, ok := xc.clients[rpcAddr]
+	if ok && !client.IsAvailable() {
+		_ = client.Close()
+		delete(xc.clients, rpcAddr)
+		ok = false
+	}
+	xc.mu.Unlock()
+	if ok {
+		return client, nil
+	}
+
+	client, err := geerpc.XDial(rpcAddr, xc.opt)
+	if err != nil {
+		return nil, err
+	}
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	// 别的 goroutine 同时连上了，用先放进缓存的那个
+	if old, ok := xc.clients[rpcAddr]; ok && old.IsAvailable() {
+		_ = client.Close()
+		return old, nil
+	}
+	xc.clients[rpcAddr] = client
+	return client, nil
+}
+
+func (xc *XClient) call(rpcAddr string, ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	client, err := xc.dial(rpcAddr)
+	if err != nil {
+		return err
+	}
+	return client.Call(ctx, serviceMethod, args, reply)
+}
+
+// Call 根据负载均衡策略选择一个服务端并调用 serviceMethod。
+// ConsistentHashSelect 时用 WithHashKey 设置的 key 选择服务端，没有设置时用 serviceMethod
+func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	rpcAddr, err := xc.pick(ctx, serviceMethod)
+	if err != nil {
+		return err
+	}
+	xc.failMu.Lock()
+	mode, retries, backoff := xc.failMode, xc.retries, xc.backoff
+	xc.failMu.Unlock()
+	switch mode {
+	case FailOver:
+		return xc.failOver(retries, rpcAddr, ctx, serviceMethod, args, reply)
+	case FailTry:
+		return xc.failTry(retries, backoff, rpcAddr, ctx, serviceMethod, args, reply)
+	default:
+		return xc.call(rpcAddr, ctx, serviceMethod, args, reply)
+	}
+}
+
+// failOver 失败之后按服务列表的顺序换下一个没有试过的服务端
+func (xc *XClient) failOver(retries int, rpcAddr string, ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	tried := map[string]bool{}
+	var err error
+	for i := 0; i <= retries; i++ {
+		tried[rpcAddr] = true
+		if err = xc.call(rpcAddr, ctx, serviceMethod, args, reply); err == nil || ctx.Err() != nil {
+			return err
+		}
+		servers, _ := xc.d.GetAll()
+		if rpcAddr = nextServer(servers, rpcAddr, tried); rpcAddr == "" {
+			break
+		}
+	}
+	return err
+}
+
+// nextServer 返回 servers 里 current 之后第一个没有试过的服务端
+func nextServer(servers []string, current string, tried map[string]bool) string {
+	start := 0
+	for i, s := range servers {
+		if s == current {
+			start = i + 1
+			break
+		}
+	}
+	for i := range servers {
+		if s := servers[(start+i)%len(servers)]; !tried[s] {
+			return s
+		}
+	}
+	return ""
+}
+
+// failTry 失败之后等一段时间在同一个服务端上重试，每次等待的时间翻倍
+func (xc *XClient) failTry(retries int, backoff time.Duration, rpcAddr string, ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	var err error
+	for i := 0; i <= retries; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		if err = xc.call(rpcAddr, ctx, serviceMethod, args, reply); err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// Broadcast 并发调用所有的服务端，有一个出错时取消其他的调用并返回这个错误，
+// 都成功时 reply 是最先返回的结果。
+// 取消只发生在客户端：客户端不再等待结果，服务端收到的调用还是会执行完
+func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		return err
+	}
+	if len(servers) == 0 {
+		return ErrNoServers
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex // 保护 e 和 replyDone
+	var e error
+	replyDone := reply == nil // reply 为 nil 时不需要设置
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for _, rpcAddr := range servers {
+		wg.Add(1)
+		go func(rpcAddr string) {
+			defer wg.Done()
+			// 每个调用用自己的 reply，避免并发写
+			var clonedReply interface{}
+			if reply != nil {
+				clonedReply = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
+			}
+			err := xc.call(rpcAddr, ctx, serviceMethod, args, clonedReply)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && e == nil {
+				e = err
+				cancel() // 有一个失败就取消还没有完成的调用
+			}
+			if err == nil && !replyDone {
+				reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(clonedReply).Elem())
+				replyDone = true
+			}
+		}(rpcAddr)
+	}
+	wg.Wait()
+	return e
+}
+
+// pick 选择一个服务端
+func (xc *XClient) pick(ctx context.Context, serviceMethod string) (string, error) {
+	if xc.mode != ConsistentHashSelect {
+		return xc.d.Get(xc.mode)
+	}
+	kd, ok := xc.d.(KeyedDiscovery)
+	if !ok {
+		return "", errors.New("rpc xclient: discovery does not support consistent hash")
+	}
+	key, ok := ctx.Value(hashKey{}).(string)
+	if !ok {
+		key = serviceMethod
+	}
+	return kd.GetByKey(key)
+}
+
+type hashKey struct{}
+
+// WithHashKey 设置一致性哈希用的 key，比如用户 ID，同一个用户的请求总是落到同一个服务端
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKey{}, key)
+}
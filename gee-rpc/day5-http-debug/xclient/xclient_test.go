@@ -0,0 +1,374 @@
+package xclient
+
+import (
+	"context"
+	geerpc "day5-http-debug"
+	"day5-http-debug/registry"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type Foo struct {
+	addr  string
+	calls int32 // Flaky 被调用的次数
+}
+
+type Args struct{ Num1, Num2 int }
+
+func (f *Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// Addr 返回处理请求的服务端地址
+func (f *Foo) Addr(_ int, reply *string) error {
+	*reply = f.addr
+	return nil
+}
+
+// Flaky 前 n 次调用失败
+func (f *Foo) Flaky(n int, reply *int) error {
+	if *reply = int(atomic.AddInt32(&f.calls, 1)); *reply <= n {
+		return errors.New("flaky")
+	}
+	return nil
+}
+
+// Sleep 等待 ms 毫秒之后返回
+func (f *Foo) Sleep(ms int, reply *int) error {
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+	*reply = ms
+	return nil
+}
+
+// startServer 启动服务端，返回 tcp@addr 格式的地址
+func startServer(t *testing.T) (string, net.Listener) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "tcp@" + l.Addr().String()
+	server := geerpc.NewServer()
+	_ = server.Register(&Foo{addr: addr})
+	go server.Accept(l)
+	return addr, l
+}
+
+func TestMultiServersDiscovery(t *testing.T) {
+	servers := []string{"a", "b", "c"}
+	d := NewMultiServerDiscovery(servers)
+
+	t.Run("round robin", func(t *testing.T) {
+		first, _ := d.Get(RoundRobinSelect)
+		start := strings.Index("abc", first)
+		for i := 1; i < 6; i++ {
+			s, _ := d.Get(RoundRobinSelect)
+			if want := servers[(start+i)%3]; s != want {
+				t.Fatalf("expect %s, got %s", want, s)
+			}
+		}
+	})
+	t.Run("weighted", func(t *testing.T) {
+		d.SetWeight("a", 5)
+		var got []string
+		for i := 0; i < 7; i++ {
+			s, _ := d.Get(WeightedSelect)
+			got = append(got, s)
+		}
+		if want := []string{"a", "a", "b", "a", "c", "a", "a"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("expect %v, got %v", want, got)
+		}
+	})
+	t.Run("consistent hash", func(t *testing.T) {
+		s1, _ := d.GetByKey("user-1")
+		for i := 0; i < 5; i++ {
+			if s, _ := d.GetByKey("user-1"); s != s1 {
+				t.Fatalf("expect the same server for the same key, got %s and %s", s1, s)
+			}
+		}
+		// 去掉别的服务端不影响这个 key
+		removed := servers[(strings.Index("abc", s1)+1)%3]
+		var rest []string
+		for _, s := range servers {
+			if s != removed {
+				rest = append(rest, s)
+			}
+		}
+		_ = d.Update(rest)
+		if s, _ := d.GetByKey("user-1"); s != s1 {
+			t.Fatalf("expect key to stay on %s, got %s", s1, s)
+		}
+		if _, err := d.Get(ConsistentHashSelect); err == nil {
+			t.Fatal("expect error without a key")
+		}
+	})
+	t.Run("no servers", func(t *testing.T) {
+		_ = d.Update(nil)
+		if _, err := d.Get(RandomSelect); err != ErrNoServers {
+			t.Fatalf("expect ErrNoServers, got %v", err)
+		}
+		if _, err := d.GetByKey("k"); err != ErrNoServers {
+			t.Fatalf("expect ErrNoServers, got %v", err)
+		}
+	})
+}
+
+func TestXClient_Call(t *testing.T) {
+	addr1, l1 := startServer(t)
+	defer l1.Close()
+	addr2, l2 := startServer(t)
+	defer l2.Close()
+
+	t.Run("round robin", func(t *testing.T) {
+		xc := NewXClient(NewMultiServerDiscovery([]string{addr1, addr2}), RoundRobinSelect, nil)
+		defer xc.Close()
+		var reply int
+		if err := xc.Call(context.Background(), "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+			t.Fatalf("expect 3, got %d, %v", reply, err)
+		}
+		seen := map[string]bool{}
+		for i := 0; i < 4; i++ {
+			var addr string
+			_ = xc.Call(context.Background(), "Foo.Addr", 0, &addr)
+			seen[addr] = true
+		}
+		if len(xc.clients) != 2 || !seen[addr1] || !seen[addr2] {
+			t.Fatalf("expect one client per server, got %d clients, seen %v", len(xc.clients), seen)
+		}
+	})
+	t.Run("consistent hash", func(t *testing.T) {
+		xc := NewXClient(NewMultiServerDiscovery([]string{addr1, addr2}), ConsistentHashSelect, nil)
+		defer xc.Close()
+		ctx := WithHashKey(context.Background(), "user-1")
+		var first string
+		_ = xc.Call(ctx, "Foo.Addr", 0, &first)
+		for i := 0; i < 5; i++ {
+			var addr string
+			if err := xc.Call(ctx, "Foo.Addr", 0, &addr); err != nil || addr != first {
+				t.Fatalf("expect %s, got %s, %v", first, addr, err)
+			}
+		}
+	})
+	t.Run("evict dead client", func(t *testing.T) {
+		xc := NewXClient(NewMultiServerDiscovery([]string{addr1}), RandomSelect, nil)
+		defer xc.Close()
+		var reply int
+		_ = xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply)
+		old := xc.clients[addr1]
+		_ = old.Close()
+		if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil || reply != 3 {
+			t.Fatalf("expect redial after client closed, got %d, %v", reply, err)
+		}
+		if xc.clients[addr1] == old {
+			t.Fatal("expect dead client to be replaced")
+		}
+	})
+	t.Run("bad address", func(t *testing.T) {
+		xc := NewXClient(NewMultiServerDiscovery([]string{"127.0.0.1:1"}), RandomSelect, nil)
+		defer xc.Close()
+		var reply int
+		if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err == nil || !strings.Contains(err.Error(), "protocol@addr") {
+			t.Fatalf("expect format error, got %v", err)
+		}
+	})
+}
+
+func TestGeeRegistryDiscovery(t *testing.T) {
+	ts := httptest.NewServer(registry.New(time.Minute))
+	defer ts.Close()
+	addr, l := startServer(t)
+	defer l.Close()
+	stop := registry.Heartbeat(ts.URL, addr, time.Minute)
+	defer stop()
+
+	d := NewGeeRegistryDiscovery(ts.URL, time.Minute)
+	if servers, err := d.GetAll(); err != nil || !reflect.DeepEqual(servers, []string{addr}) {
+		t.Fatalf("expect %v from registry, got %v, %v", addr, servers, err)
+	}
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	defer xc.Close()
+	var reply int
+	if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("expect 3, got %d, %v", reply, err)
+	}
+}
+
+func TestGeeRegistryDiscovery_RegistryDown(t *testing.T) {
+	ts := httptest.NewServer(registry.New(time.Minute))
+	stop := registry.Heartbeat(ts.URL, "tcp@127.0.0.1:9001", time.Minute)
+	stop()
+	d := NewGeeRegistryDiscovery(ts.URL, time.Millisecond)
+	_ = d.Update([]string{"tcp@127.0.0.1:9001"})
+	ts.Close()
+
+	// 注册中心连不上时继续用旧的服务列表
+	time.Sleep(5 * time.Millisecond)
+	if s, err := d.Get(RandomSelect); err != nil || s != "tcp@127.0.0.1:9001" {
+		t.Fatalf("expect stale server, got %s, %v", s, err)
+	}
+	if d.retryAt.IsZero() {
+		t.Fatal("expect failed refresh to delay the next retry")
+	}
+
+	// 没有旧的服务列表时返回错误
+	empty := NewGeeRegistryDiscovery(ts.URL, time.Minute)
+	if _, err := empty.GetAll(); err == nil {
+		t.Fatal("expect error without cached servers")
+	}
+}
+
+func TestXClient_ConcurrentDial(t *testing.T) {
+	addr, l := startServer(t)
+	defer l.Close()
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr}), RandomSelect, nil)
+	defer xc.Close()
+
+	clients := make(chan *geerpc.Client, 10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			client, err := xc.dial(addr)
+			if err != nil {
+				t.Error(err)
+			}
+			clients <- client
+		}()
+	}
+	first := <-clients
+	for i := 1; i < 10; i++ {
+		if client := <-clients; client != first {
+			t.Fatal("expect concurrent dials to share one client")
+		}
+	}
+}
+
+// deadAddr 返回一个没有服务端监听的地址
+func deadAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = l.Close()
+	return "tcp@" + l.Addr().String()
+}
+
+func TestXClient_FailMode(t *testing.T) {
+	addr, l := startServer(t)
+	defer l.Close()
+	dead := deadAddr(t)
+
+	t.Run("fail fast", func(t *testing.T) {
+		xc := NewXClient(NewMultiServerDiscovery([]string{dead}), RandomSelect, nil)
+		defer xc.Close()
+		var reply int
+		if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err == nil {
+			t.Fatal("expect error from dead server")
+		}
+	})
+	t.Run("fail over", func(t *testing.T) {
+		xc := NewXClient(NewMultiServerDiscovery([]string{dead, addr}), RoundRobinSelect, nil)
+		defer xc.Close()
+		xc.SetFailMode(FailOver, 1, 0)
+		for i := 0; i < 4; i++ {
+			var reply int
+			if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil || reply != 3 {
+				t.Fatalf("expect fail over to %s, got %d, %v", addr, reply, err)
+			}
+		}
+	})
+	t.Run("fail try", func(t *testing.T) {
+		xc := NewXClient(NewMultiServerDiscovery([]string{addr}), RandomSelect, nil)
+		defer xc.Close()
+		xc.SetFailMode(FailTry, 3, 10*time.Millisecond)
+		var reply int
+		start := time.Now()
+		if err := xc.Call(context.Background(), "Foo.Flaky", 2, &reply); err != nil || reply != 3 {
+			t.Fatalf("expect success on the 3rd call, got %d, %v", reply, err)
+		}
+		// 等待 10ms + 20ms
+		if d := time.Since(start); d < 30*time.Millisecond {
+			t.Fatalf("expect backoff between retries, took %s", d)
+		}
+		// 重试次数用完了还是返回错误
+		xc.SetFailMode(FailTry, 1, time.Millisecond)
+		if err := xc.Call(context.Background(), "Foo.Flaky", 10, &reply); err == nil {
+			t.Fatal("expect error after retries exhausted")
+		}
+	})
+	t.Run("fail try canceled", func(t *testing.T) {
+		xc := NewXClient(NewMultiServerDiscovery([]string{dead}), RandomSelect, nil)
+		defer xc.Close()
+		xc.SetFailMode(FailTry, 3, time.Hour)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		var reply int
+		if err := xc.Call(ctx, "Foo.Sum", Args{1, 2}, &reply); err == nil {
+			t.Fatal("expect error after context canceled")
+		}
+	})
+}
+
+func TestXClient_Broadcast(t *testing.T) {
+	addr1, l1 := startServer(t)
+	defer l1.Close()
+	addr2, l2 := startServer(t)
+	defer l2.Close()
+
+	t.Run("success", func(t *testing.T) {
+		xc := NewXClient(NewMultiServerDiscovery([]string{addr1, addr2}), RandomSelect, nil)
+		defer xc.Close()
+		var reply int
+		if err := xc.Broadcast(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil || reply != 3 {
+			t.Fatalf("expect 3, got %d, %v", reply, err)
+		}
+		if len(xc.clients) != 2 {
+			t.Fatalf("expect every server to be called, got %d clients", len(xc.clients))
+		}
+	})
+	t.Run("cancel on error", func(t *testing.T) {
+		xc := NewXClient(NewMultiServerDiscovery([]string{addr1, deadAddr(t)}), RandomSelect, nil)
+		defer xc.Close()
+		var reply int
+		start := time.Now()
+		if err := xc.Broadcast(context.Background(), "Foo.Sleep", 2000, &reply); err == nil {
+			t.Fatal("expect error from dead server")
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Fatalf("expect slow call to be canceled, took %s", d)
+		}
+	})
+	t.Run("no servers", func(t *testing.T) {
+		xc := NewXClient(NewMultiServerDiscovery(nil), RandomSelect, nil)
+		defer xc.Close()
+		if err := xc.Broadcast(context.Background(), "Foo.Sum", Args{1, 2}, nil); err != ErrNoServers {
+			t.Fatalf("expect ErrNoServers, got %v", err)
+		}
+	})
+}
+
+// SetFailMode 和 Call 并发调用，用 -race 运行
+func TestXClient_SetFailModeConcurrent(t *testing.T) {
+	addr, l := startServer(t)
+	defer l.Close()
+	xc := NewXClient(NewMultiServerDiscovery([]string{addr}), RandomSelect, nil)
+	defer xc.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			xc.SetFailMode(FailMode(i%3), 1, time.Millisecond)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		var reply int
+		if err := xc.Call(context.Background(), "Foo.Sum", Args{1, 2}, &reply); err != nil || reply != 3 {
+			t.Fatalf("expect 3, got %d, %v", reply, err)
+		}
+	}
+	<-done
+}
@@ -1,6 +1,6 @@
 module day7-panic-recover
 
-go 1.19
+go 1.24
 require pee v0.0.0
 
 replace pee => ./pee
\ No newline at end of file
@@ -0,0 +1,283 @@
+package pee
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// BreakerState 熔断器的状态
+type BreakerState int
+
+const (
+	StateClosed   BreakerState = iota // 正常放行
+	StateOpen                         // 熔断，直接返回 ErrCircuitOpen
+	StateHalfOpen                     // 放行少量试探请求，成功就关闭，失败继续熔断
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// ErrCircuitOpen 熔断时 Do 和 Allow 返回的错误
+var ErrCircuitOpen = errors.New("pee: circuit breaker is open")
+
+// BreakerConfig 熔断器的配置
+type BreakerConfig struct {
+	Name             string
+	Window           time.Duration        // 统计错误率的滚动窗口，默认10s，至少 Buckets 纳秒
+	Buckets          int                  // 窗口分成多少个桶，默认10
+	MinRequests      int                  // 窗口内的请求少于它时不熔断，默认20
+	ErrorRate        float64              // 错误率达到它时熔断，默认0.5
+	OpenTimeout      time.Duration        // 熔断多久之后进入半开，默认5s
+	HalfOpenRequests int                  // 半开时放行的试探请求数，全部成功才关闭，默认1
+	ProbeTimeout     time.Duration        // 试探请求多久没有结束算失败，重新熔断，默认等于 OpenTimeout
+	IsFailure        func(err error) bool // 哪些错误算失败，默认 err != nil
+	// OnStateChange 在锁外面按状态变化的顺序调用，回调里可以调用 State
+	OnStateChange func(name string, from BreakerState, to BreakerState)
+}
+
+// 一次状态变化，等着调用 OnStateChange
+type breakerTransition struct {
+	from BreakerState
+	to   BreakerState
+}
+
+// 一个桶里的计数，epoch 是桶对应的时间段
+type breakerBucket struct {
+	epoch    int64
+	total    int
+	failures int
+}
+
+// CircuitBreaker 熔断器，包住对下游的调用：
+//
+//	cb := pee.NewCircuitBreaker(pee.BreakerConfig{Name: "user-service"})
+//	err := cb.Do(func() error { return client.Call(ctx, "user.show", nil, &user, "id", id) })
+type CircuitBreaker struct {
+	conf BreakerConfig
+	now  func() time.Time
+
+	mu         sync.Mutex
+	state      BreakerState
+	generation uint64 // 状态每变一次加一，旧状态下放行的请求结果不再统计
+	buckets    []breakerBucket
+	openedAt   time.Time
+	probes     int       // 半开时已经放行的请求
+	successes  int       // 半开时成功的请求
+	probeAt    time.Time // 最后一个试探请求放行的时间
+
+	pending   []breakerTransition // 还没有通知的状态变化
+	notifying bool                // 有 goroutine 正在调用 OnStateChange
+}
+
+// NewCircuitBreaker 创建熔断器，没有设置的配置使用默认值
+func NewCircuitBreaker(conf BreakerConfig) *CircuitBreaker {
+	if conf.Window <= 0 {
+		conf.Window = 10 * time.Second
+	}
+	if conf.Buckets <= 0 {
+		conf.Buckets = 10
+	}
+	// 每个桶至少 1ns，不然算桶的时候会除以 0
+	if conf.Window < time.Duration(conf.Buckets) {
+		conf.Window = time.Duration(conf.Buckets)
+	}
+	if conf.MinRequests <= 0 {
+		conf.MinRequests = 20
+	}
+	if conf.ErrorRate <= 0 {
+		conf.ErrorRate = 0.5
+	}
+	if conf.OpenTimeout <= 0 {
+		conf.OpenTimeout = 5 * time.Second
+	}
+	if conf.HalfOpenRequests <= 0 {
+		conf.HalfOpenRequests = 1
+	}
+	if conf.ProbeTimeout <= 0 {
+		conf.ProbeTimeout = conf.OpenTimeout
+	}
+	if conf.IsFailure == nil {
+		conf.IsFailure = func(err error) bool { return err != nil }
+	}
+	return &CircuitBreaker{conf: conf, now: time.Now, buckets: make([]breakerBucket, conf.Buckets)}
+}
+
+// Do 熔断时直接返回 ErrCircuitOpen，否则执行 fn 并记录结果
+func (b *CircuitBreaker) Do(fn func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	done(err)
+	return err
+}
+
+// Allow 判断能不能调用下游，能调用时调用结束后要用调用的结果执行 done
+func (b *CircuitBreaker) Allow() (done func(err error), err error) {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	b.checkOpenTimeout(now)
+	switch b.state {
+	case StateOpen:
+		return nil, ErrCircuitOpen
+	case StateHalfOpen:
+		if b.probes >= b.conf.HalfOpenRequests {
+			return nil, ErrCircuitOpen
+		}
+		b.probes++
+		b.probeAt = now
+	}
+	generation := b.generation
+	return func(err error) {
+		b.record(generation, b.conf.IsFailure(err))
+	}, nil
+}
+
+// State 返回当前的状态
+func (b *CircuitBreaker) State() BreakerState {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checkOpenTimeout(b.now())
+	return b.state
+}
+
+// ReportTo 把熔断器的状态注册到 Metrics，0 关闭、1 熔断、2 半开
+func (b *CircuitBreaker) ReportTo(m *Metrics) {
+	m.GaugeFunc("pee_circuit_breaker_state", "Circuit breaker state: 0 closed, 1 open, 2 half-open.",
+		func() float64 { return float64(b.State()) }, "name", b.conf.Name)
+}
+
+// 熔断时间到了进入半开，半开时试探请求太久没有结束就重新熔断
+func (b *CircuitBreaker) checkOpenTimeout(now time.Time) {
+	switch {
+	case b.state == StateOpen && now.Sub(b.openedAt) >= b.conf.OpenTimeout:
+		b.setState(StateHalfOpen, now)
+	case b.state == StateHalfOpen && b.probes > b.successes && now.Sub(b.probeAt) >= b.conf.ProbeTimeout:
+		b.setState(StateOpen, now)
+	}
+}
+
+// 记录一次调用的结果
+func (b *CircuitBreaker) record(generation uint64, failed bool) {
+	defer b.notify()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	now := b.now()
+	switch b.state {
+	case StateHalfOpen:
+		if failed {
+			b.setState(StateOpen, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.conf.HalfOpenRequests {
+			b.setState(StateClosed, now)
+		}
+	case StateClosed:
+		bucket := b.bucket(now)
+		bucket.total++
+		if failed {
+			bucket.failures++
+		}
+		total, failures := b.counts(now)
+		if total >= b.conf.MinRequests && float64(failures)/float64(total) >= b.conf.ErrorRate {
+			b.setState(StateOpen, now)
+		}
+	}
+}
+
+// 当前时间对应的桶，桶过期了先清零
+func (b *CircuitBreaker) bucket(now time.Time) *breakerBucket {
+	epoch := now.UnixNano() / int64(b.conf.Window/time.Duration(b.conf.Buckets))
+	bucket := &b.buckets[epoch%int64(len(b.buckets))]
+	if bucket.epoch != epoch {
+		*bucket = breakerBucket{epoch: epoch}
+	}
+	return bucket
+}
+
+// 滚动窗口内的请求数和失败数
+func (b *CircuitBreaker) counts(now time.Time) (total int, failures int) {
+	epoch := now.UnixNano() / int64(b.conf.Window/time.Duration(b.conf.Buckets))
+	for _, bucket := range b.buckets {
+		if epoch-bucket.epoch < int64(len(b.buckets)) {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+	return
+}
+
+// 切换状态，清空统计
+func (b *CircuitBreaker) setState(state BreakerState, now time.Time) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.probes, b.successes = 0, 0
+	for i := range b.buckets {
+		b.buckets[i] = breakerBucket{}
+	}
+	if state == StateOpen {
+		b.openedAt = now
+	}
+	if b.conf.OnStateChange != nil {
+		// 回调里可能会调用 State，先记下来，释放锁之后由 notify 调用
+		b.pending = append(b.pending, breakerTransition{from: from, to: state})
+	}
+}
+
+// 按顺序调用 OnStateChange，同一时间只有一个 goroutine 在调用，
+// 其他 goroutine 产生的状态变化排在后面由它一起通知
+func (b *CircuitBreaker) notify() {
+	if b.conf.OnStateChange == nil {
+		return
+	}
+	b.mu.Lock()
+	if b.notifying {
+		b.mu.Unlock()
+		return
+	}
+	b.notifying = true
+	for len(b.pending) > 0 {
+		pending := b.pending
+		b.pending = nil
+		b.mu.Unlock()
+		b.callStateChange(pending)
+		b.mu.Lock()
+	}
+	b.notifying = false
+	b.mu.Unlock()
+}
+
+// 回调 panic 时也要让之后的状态变化能通知出去
+func (b *CircuitBreaker) callStateChange(pending []breakerTransition) {
+	ok := false
+	defer func() {
+		if !ok {
+			b.mu.Lock()
+			b.notifying = false
+			b.mu.Unlock()
+		}
+	}()
+	for _, t := range pending {
+		b.conf.OnStateChange(b.conf.Name, t.from, t.to)
+	}
+	ok = true
+}
@@ -0,0 +1,124 @@
+package pee
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := NewCircuitBreaker(BreakerConfig{Name: "db", MinRequests: 4, ErrorRate: 0.5, OpenTimeout: time.Second, HalfOpenRequests: 2})
+	b.now = func() time.Time { return now }
+	fail := errors.New("downstream failed")
+	call := func(err error) error { return b.Do(func() error { return err }) }
+
+	call(nil)
+	call(nil)
+	call(fail)
+	if b.State() != StateClosed {
+		t.Fatal("too few requests to open")
+	}
+	call(fail)
+	if b.State() != StateOpen {
+		t.Fatalf("expect open at 50%% errors, got %s", b.State())
+	}
+	if err := call(nil); err != ErrCircuitOpen {
+		t.Fatalf("expect ErrCircuitOpen, got %v", err)
+	}
+
+	// 过了 OpenTimeout 进入半开，试探失败继续熔断
+	now = now.Add(time.Second)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("expect half-open, got %s", b.State())
+	}
+	call(fail)
+	if b.State() != StateOpen {
+		t.Fatalf("failed probe should reopen, got %s", b.State())
+	}
+
+	// 试探全部成功才关闭，试探数用完之前其他请求还是被拒绝
+	now = now.Add(time.Second)
+	done1, err1 := b.Allow()
+	done2, err2 := b.Allow()
+	if _, err := b.Allow(); err1 != nil || err2 != nil || err != ErrCircuitOpen {
+		t.Fatalf("expect exactly two probes, got %v %v %v", err1, err2, err)
+	}
+	done1(nil)
+	done2(nil)
+	if b.State() != StateClosed {
+		t.Fatalf("expect closed after successful probes, got %s", b.State())
+	}
+
+	// 窗口外的失败不再统计
+	call(fail)
+	call(fail)
+	call(fail)
+	now = now.Add(11 * time.Second)
+	call(fail)
+	if b.State() != StateClosed {
+		t.Fatal("failures outside the window should be forgotten")
+	}
+}
+
+func TestCircuitBreakerMetrics(t *testing.T) {
+	m := NewMetrics()
+	b := NewCircuitBreaker(BreakerConfig{Name: "db", MinRequests: 1})
+	b.ReportTo(m)
+	b.Do(func() error { return errors.New("failed") })
+	var out strings.Builder
+	m.WriteTo(&out)
+	if !strings.Contains(out.String(), "# TYPE pee_circuit_breaker_state gauge\npee_circuit_breaker_state{name=\"db\"} 1\n") {
+		t.Fatalf("expect breaker state in metrics, got\n%s", out.String())
+	}
+}
+
+func TestCircuitBreakerStateChange(t *testing.T) {
+	now := time.Unix(1000, 0)
+	var got []string
+	var b *CircuitBreaker
+	b = NewCircuitBreaker(BreakerConfig{
+		Name: "db", MinRequests: 1, OpenTimeout: time.Second, ProbeTimeout: 3 * time.Second,
+		OnStateChange: func(name string, from BreakerState, to BreakerState) {
+			// 回调里调用 State 不会死锁，也不会打乱顺序
+			b.State()
+			got = append(got, from.String()+"->"+to.String())
+		},
+	})
+	b.now = func() time.Time { return now }
+
+	_ = b.Do(func() error { return errors.New("failed") })
+	now = now.Add(time.Second)
+	// 试探请求一直没有结束，超过 ProbeTimeout 重新熔断
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(3 * time.Second)
+	if b.State() != StateOpen {
+		t.Fatalf("expect hung probe to reopen, got %s", b.State())
+	}
+	// 超时之后才结束的试探请求不再统计
+	done(nil)
+	if b.State() != StateOpen {
+		t.Fatalf("expect late probe result to be ignored, got %s", b.State())
+	}
+	now = now.Add(time.Second)
+	_ = b.Do(func() error { return nil })
+
+	want := "closed->open open->half-open half-open->open open->half-open half-open->closed"
+	if s := strings.Join(got, " "); s != want {
+		t.Fatalf("expect transitions %q, got %q", want, s)
+	}
+}
+
+func TestCircuitBreakerTinyWindow(t *testing.T) {
+	b := NewCircuitBreaker(BreakerConfig{Window: 5, MinRequests: 1})
+	if err := b.Do(func() error { return errors.New("failed") }); err == nil {
+		t.Fatal("expect the error from fn")
+	}
+	if b.State() != StateOpen {
+		t.Fatalf("expect open, got %s", b.State())
+	}
+}
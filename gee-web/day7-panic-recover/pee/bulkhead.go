@@ -0,0 +1,81 @@
+package pee
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// BulkheadConfig 并发限制中间件的配置
+type BulkheadConfig struct {
+	MaxConcurrent int           // 同时处理的请求数
+	MaxQueue      int           // 满了之后最多排队的请求数，0 表示不排队
+	QueueTimeout  time.Duration // 排队最多等多久，0 表示一直等到请求取消
+	StatusCode    int           // 拒绝时返回的状态码，默认503
+	Body          string        // 拒绝时返回的内容
+	ContentType   string
+}
+
+// Bulkhead 限制分组或者路由同时处理的请求数，超过时直接返回503，
+// 一个慢的下游不会占满所有的 goroutine 拖垮别的接口
+func Bulkhead(maxConcurrent int) HandlerFunc {
+	return BulkheadWithConfig(BulkheadConfig{MaxConcurrent: maxConcurrent})
+}
+
+// BulkheadWithConfig 限制同时处理的请求数，可以配置排队
+func BulkheadWithConfig(conf BulkheadConfig) HandlerFunc {
+	if conf.MaxConcurrent <= 0 {
+		panic("pee: bulkhead needs MaxConcurrent > 0")
+	}
+	if conf.StatusCode == 0 {
+		conf.StatusCode = http.StatusServiceUnavailable
+	}
+	if conf.Body == "" {
+		conf.Body = http.StatusText(conf.StatusCode)
+	}
+	if conf.ContentType == "" {
+		conf.ContentType = "text/plain; charset=utf-8"
+	}
+	slots := make(chan struct{}, conf.MaxConcurrent)
+	var queued atomic.Int64
+
+	reject := func(c *Context) {
+		c.Abort()
+		c.SetHeader("Content-Type", conf.ContentType)
+		c.SetHeader("Retry-After", "1")
+		c.Status(conf.StatusCode)
+		c.Writer.Write([]byte(conf.Body))
+	}
+	return func(c *Context) {
+		select {
+		case slots <- struct{}{}:
+		default:
+			// 满了，看能不能排队
+			if queued.Add(1) > int64(conf.MaxQueue) {
+				queued.Add(-1)
+				reject(c)
+				return
+			}
+			var timeout <-chan time.Time
+			if conf.QueueTimeout > 0 {
+				timer := time.NewTimer(conf.QueueTimeout)
+				defer timer.Stop()
+				timeout = timer.C
+			}
+			select {
+			case slots <- struct{}{}:
+				queued.Add(-1)
+			case <-timeout:
+				queued.Add(-1)
+				reject(c)
+				return
+			case <-c.Req.Context().Done():
+				queued.Add(-1)
+				c.Abort()
+				return
+			}
+		}
+		defer func() { <-slots }()
+		c.Next()
+	}
+}
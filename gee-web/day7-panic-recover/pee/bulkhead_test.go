@@ -0,0 +1,64 @@
+package pee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulkhead(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 4)
+	r := New(WithMode(TestMode))
+	r.Use(BulkheadWithConfig(BulkheadConfig{MaxConcurrent: 1, MaxQueue: 1, QueueTimeout: time.Second}))
+	r.GET("/slow", func(c *Context) {
+		started <- struct{}{}
+		<-release
+		c.String(http.StatusOK, "ok")
+	})
+
+	codes := make(chan int, 3)
+	var wg sync.WaitGroup
+	send := func() {
+		defer wg.Done()
+		codes <- serve(r, httptest.NewRequest("GET", "/slow", nil)).Code
+	}
+	wg.Add(1)
+	go send()
+	<-started // 第一个请求占住了唯一的位置
+	wg.Add(1)
+	go send() // 第二个排队
+	time.Sleep(50 * time.Millisecond)
+
+	// 队列也满了，第三个直接拒绝
+	if w := serve(r, httptest.NewRequest("GET", "/slow", nil)); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expect 503 when saturated, got %d", w.Code)
+	}
+	close(release)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Fatalf("expect queued request to be served, got %d", code)
+		}
+	}
+}
+
+func TestBulkheadQueueTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	r := New(WithMode(TestMode))
+	r.Use(BulkheadWithConfig(BulkheadConfig{MaxConcurrent: 1, MaxQueue: 1, QueueTimeout: 20 * time.Millisecond}))
+	r.GET("/slow", func(c *Context) {
+		close(started)
+		<-release
+	})
+	go serve(r, httptest.NewRequest("GET", "/slow", nil))
+	<-started
+	if w := serve(r, httptest.NewRequest("GET", "/slow", nil)); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expect 503 after waiting in queue, got %d", w.Code)
+	}
+}
@@ -0,0 +1,390 @@
+package pee
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bufferWriter 先把响应体缓存下来，等handler执行完再决定怎么写，响应头直接写在下层的Header里。
+// handler 调用 Flush 或者 Hijack 时说明是流式响应或者接管了连接，之后直接写到下层，不再缓存
+type bufferWriter struct {
+	http.ResponseWriter
+	buf         bytes.Buffer
+	status      int
+	passthrough bool
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *bufferWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buf.Write(data)
+}
+
+// Flush 先把缓存的内容写出去，之后不再缓存
+func (w *bufferWriter) Flush() {
+	if !w.passthrough {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(w.code())
+		w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 转发给下层的 http.Hijacker，接管连接之后中间件什么都不写
+func (w *bufferWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("pee: response writer does not support hijacking")
+	}
+	w.passthrough = true
+	return h.Hijack()
+}
+
+// 没有写过状态码时默认200
+func (w *bufferWriter) code() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// ETagConfig ETag 中间件的配置
+type ETagConfig struct {
+	Weak bool // 生成 W/"..." 形式的弱 ETag
+}
+
+// ETag 给 GET、HEAD 的200响应计算强 ETag，并处理 If-None-Match、If-Modified-Since
+func ETag() HandlerFunc {
+	return ETagWithConfig(ETagConfig{})
+}
+
+// ETagWithConfig 可以选择强弱 ETag 的 ETag 中间件，handler 自己设置了 ETag 时不会覆盖
+func ETagWithConfig(conf ETagConfig) HandlerFunc {
+	return func(c *Context) {
+		if c.Method != http.MethodGet && c.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		w := c.Writer
+		bw := &bufferWriter{ResponseWriter: w}
+		c.Writer = bw
+		defer func() { c.Writer = w }()
+		c.Next()
+		if bw.passthrough {
+			return
+		}
+
+		status := bw.code()
+		header := w.Header()
+		if status == http.StatusOK && header.Get("ETag") == "" {
+			sum := sha1.Sum(bw.buf.Bytes())
+			etag := `"` + hex.EncodeToString(sum[:]) + `"`
+			if conf.Weak {
+				etag = "W/" + etag
+			}
+			header.Set("ETag", etag)
+		}
+		if status == http.StatusOK && notModified(c.Req, header) {
+			header.Del("Content-Type")
+			header.Del("Content-Length")
+			c.StatusCode = http.StatusNotModified
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write(bw.buf.Bytes())
+	}
+}
+
+// 条件请求是否可以返回304，If-None-Match 优先于 If-Modified-Since
+func notModified(req *http.Request, header http.Header) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			// If-None-Match 使用弱比较
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	ims, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(ims)
+}
+
+// CacheConfig 响应缓存的配置
+type CacheConfig struct {
+	TTL         time.Duration // 响应没有 max-age 时的缓存时间，默认1分钟
+	MaxEntries  int           // 最多缓存多少个响应，超过时淘汰最久没用的，默认1000
+	MaxBodySize int           // 单个响应最大多少字节，默认1MB
+	VaryHeaders []string      // 参与缓存key的请求头，比如 Accept-Language
+}
+
+// cacheEntry 缓存的一个响应
+type cacheEntry struct {
+	key     string
+	status  int
+	header  http.Header
+	body    []byte
+	created time.Time
+	expires time.Time
+	vary    map[string]string // 响应的 Vary 列出的请求头和存的时候请求里的值，不一样时不能用
+}
+
+// ResponseCache 按方法、host、路径和指定请求头缓存 GET、HEAD 响应的内存缓存，遵守 Cache-Control 和 Vary。
+// 带 Authorization 的请求只有响应是 public 或者有 s-maxage 时才缓存
+type ResponseCache struct {
+	mu    sync.Mutex
+	conf  CacheConfig
+	ll    *list.List // 最近使用的在前面
+	items map[string]*list.Element
+}
+
+// NewResponseCache 创建响应缓存，用法 r.Use(pee.NewResponseCache(conf).Middleware())
+func NewResponseCache(conf CacheConfig) *ResponseCache {
+	if conf.TTL == 0 {
+		conf.TTL = time.Minute
+	}
+	if conf.MaxEntries == 0 {
+		conf.MaxEntries = 1000
+	}
+	if conf.MaxBodySize == 0 {
+		conf.MaxBodySize = 1 << 20
+	}
+	return &ResponseCache{conf: conf, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Len 缓存的响应数量
+func (rc *ResponseCache) Len() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.ll.Len()
+}
+
+// Purge 清空缓存
+func (rc *ResponseCache) Purge() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.ll.Init()
+	rc.items = make(map[string]*list.Element)
+}
+
+func (rc *ResponseCache) key(req *http.Request) string {
+	var b strings.Builder
+	// 按 host 注册的路由，不同 host 的同一个路径是不同的响应
+	b.WriteString(req.Method + " " + req.Host + req.URL.RequestURI())
+	for _, name := range rc.conf.VaryHeaders {
+		b.WriteString("\n" + name + ": " + req.Header.Get(name))
+	}
+	return b.String()
+}
+
+func (rc *ResponseCache) get(key string, req *http.Request) *cacheEntry {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	ele, ok := rc.items[key]
+	if !ok {
+		return nil
+	}
+	entry := ele.Value.(*cacheEntry)
+	for name, value := range entry.vary {
+		if strings.Join(req.Header.Values(name), ",") != value {
+			return nil
+		}
+	}
+	if time.Now().After(entry.expires) {
+		rc.ll.Remove(ele)
+		delete(rc.items, key)
+		return nil
+	}
+	rc.ll.MoveToFront(ele)
+	return entry
+}
+
+func (rc *ResponseCache) add(entry *cacheEntry) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if ele, ok := rc.items[entry.key]; ok {
+		ele.Value = entry
+		rc.ll.MoveToFront(ele)
+		return
+	}
+	rc.items[entry.key] = rc.ll.PushFront(entry)
+	for rc.ll.Len() > rc.conf.MaxEntries {
+		oldest := rc.ll.Back()
+		rc.ll.Remove(oldest)
+		delete(rc.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// after 里新加的或者值变了的响应头
+func headerChanges(before http.Header, after http.Header) http.Header {
+	changed := make(http.Header)
+	for k, v := range after {
+		if old, ok := before[k]; !ok || !slices.Equal(old, v) {
+			changed[k] = slices.Clone(v)
+		}
+	}
+	return changed
+}
+
+// 解析 Cache-Control，返回指令和对应的值
+func parseCacheControl(header string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if key != "" {
+			directives[strings.ToLower(key)] = strings.Trim(value, `"`)
+		}
+	}
+	return directives
+}
+
+// 响应的 Vary 列出的请求头在这个请求里的值，Vary: * 时返回 false，不能缓存
+func varyValues(header http.Header, req *http.Request) (map[string]string, bool) {
+	vary := make(map[string]string)
+	for _, line := range header.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			if name != "" {
+				name = http.CanonicalHeaderKey(name)
+				vary[name] = strings.Join(req.Header.Values(name), ",")
+			}
+		}
+	}
+	return vary, true
+}
+
+// 响应可以缓存多久，返回0表示不能缓存。
+// authorized 是请求带了 Authorization，这时响应要明确是 public 或者有 s-maxage 才能共享（RFC 9111 3.5）
+func (rc *ResponseCache) ttl(header http.Header, authorized bool) time.Duration {
+	if header.Get("Set-Cookie") != "" {
+		return 0
+	}
+	cc := parseCacheControl(header.Get("Cache-Control"))
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := cc[d]; ok {
+			return 0
+		}
+	}
+	if authorized {
+		_, public := cc["public"]
+		_, sMaxAge := cc["s-maxage"]
+		if !public && !sMaxAge {
+			return 0
+		}
+	}
+	for _, d := range []string{"s-maxage", "max-age"} {
+		if v, ok := cc[d]; ok {
+			seconds, err := strconv.Atoi(v)
+			if err != nil || seconds <= 0 {
+				return 0
+			}
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return rc.conf.TTL
+}
+
+// Middleware 缓存中间件，命中时直接返回缓存的响应，并带上 X-Cache 和 Age 响应头
+func (rc *ResponseCache) Middleware() HandlerFunc {
+	return func(c *Context) {
+		if c.Method != http.MethodGet && c.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		reqCC := parseCacheControl(c.Req.Header.Get("Cache-Control"))
+		if _, ok := reqCC["no-store"]; ok {
+			c.Next()
+			return
+		}
+		key := rc.key(c.Req)
+		_, noCache := reqCC["no-cache"]
+		if maxAge, ok := reqCC["max-age"]; ok && maxAge == "0" {
+			noCache = true
+		}
+		if !noCache {
+			if entry := rc.get(key, c.Req); entry != nil {
+				c.Abort()
+				header := c.Writer.Header()
+				for k, v := range entry.header {
+					header[k] = slices.Clone(v) // 缓存的切片是共用的，不能让后面的 Add 改到它
+				}
+				header.Set("X-Cache", "HIT")
+				header.Set("Age", strconv.Itoa(int(time.Since(entry.created).Seconds())))
+				c.Status(entry.status)
+				c.Writer.Write(entry.body)
+				return
+			}
+		}
+
+		w := c.Writer
+		// 外层中间件为这个请求设置的响应头（比如 X-Request-ID）不能缓存，只缓存后面的handler设置的
+		before := w.Header().Clone()
+		bw := &bufferWriter{ResponseWriter: w}
+		c.Writer = bw
+		defer func() { c.Writer = w }()
+		c.Next()
+		if bw.passthrough {
+			return
+		}
+
+		status := bw.code()
+		if status == http.StatusOK && bw.buf.Len() <= rc.conf.MaxBodySize {
+			vary, ok := varyValues(w.Header(), c.Req)
+			if ttl := rc.ttl(w.Header(), c.Req.Header.Get("Authorization") != ""); ok && ttl > 0 {
+				now := time.Now()
+				rc.add(&cacheEntry{
+					key:     key,
+					status:  status,
+					header:  headerChanges(before, w.Header()),
+					body:    append([]byte(nil), bw.buf.Bytes()...),
+					created: now,
+					expires: now.Add(ttl),
+					vary:    vary,
+				})
+			}
+		}
+		w.Header().Set("X-Cache", "MISS")
+		w.WriteHeader(status)
+		w.Write(bw.buf.Bytes())
+	}
+}
@@ -0,0 +1,185 @@
+package pee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestETag(t *testing.T) {
+	r := New()
+	r.Use(ETag())
+	r.GET("/users", func(c *Context) { c.JSON(http.StatusOK, H{"name": "lzj"}) })
+	r.GET("/doc", func(c *Context) {
+		c.SetHeader("Last-Modified", "Mon, 13 Feb 2023 10:00:00 GMT")
+		c.Data(http.StatusOK, []byte("doc"))
+	})
+
+	w := serve(r, httptest.NewRequest("GET", "/users", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || len(etag) != 42 || w.Body.Len() == 0 {
+		t.Fatalf("expect a strong etag, got %d %q", w.Code, etag)
+	}
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("If-None-Match", `"other", W/`+etag)
+	if w := serve(r, req); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("expect 304, got %d %q", w.Code, w.Body.String())
+	}
+	req = httptest.NewRequest("GET", "/doc", nil)
+	req.Header.Set("If-Modified-Since", "Mon, 13 Feb 2023 10:00:00 GMT")
+	if w := serve(r, req); w.Code != http.StatusNotModified {
+		t.Fatalf("expect 304, got %d", w.Code)
+	}
+	req.Header.Set("If-Modified-Since", "Mon, 13 Feb 2023 09:00:00 GMT")
+	if w := serve(r, req); w.Code != http.StatusOK || w.Body.String() != "doc" {
+		t.Fatalf("expect 200, got %d", w.Code)
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	cache := NewResponseCache(CacheConfig{TTL: time.Minute, MaxEntries: 2, VaryHeaders: []string{"Accept-Language"}})
+	r := New()
+	r.Use(cache.Middleware())
+	calls := 0
+	r.GET("/hello/:name", func(c *Context) {
+		calls++
+		c.String(http.StatusOK, "hello %s %d", c.Param("name"), calls)
+	})
+	r.GET("/private", func(c *Context) {
+		calls++
+		c.SetHeader("Cache-Control", "private")
+		c.String(http.StatusOK, "private")
+	})
+
+	get := func(path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		return serve(r, req)
+	}
+	if w := get("/hello/a"); w.Header().Get("X-Cache") != "MISS" || w.Body.String() != "hello a 1" {
+		t.Fatalf("expect a miss, got %q", w.Body.String())
+	}
+	if w := get("/hello/a"); w.Header().Get("X-Cache") != "HIT" || w.Body.String() != "hello a 1" {
+		t.Fatalf("expect a hit, got %q", w.Body.String())
+	}
+	if w := get("/hello/a", "Accept-Language", "zh"); w.Body.String() != "hello a 2" {
+		t.Fatalf("vary header should be part of the key, got %q", w.Body.String())
+	}
+	if w := get("/hello/a", "Cache-Control", "no-cache"); w.Body.String() != "hello a 3" {
+		t.Fatalf("no-cache should skip the cache, got %q", w.Body.String())
+	}
+	get("/private")
+	get("/private")
+	if calls != 5 || cache.Len() != 2 {
+		t.Fatalf("private responses shouldn't be cached, calls %d, len %d", calls, cache.Len())
+	}
+	get("/hello/b")
+	if cache.Len() != 2 {
+		t.Fatalf("expect at most 2 entries, got %d", cache.Len())
+	}
+}
+
+func TestResponseCache_RequestHeaders(t *testing.T) {
+	r := New()
+	r.Use(RequestID(), NewResponseCache(CacheConfig{}).Middleware())
+	r.GET("/users", func(c *Context) {
+		c.SetHeader("X-Handler", "users")
+		c.String(http.StatusOK, "users")
+	})
+
+	first := serve(r, httptest.NewRequest("GET", "/users", nil))
+	second := serve(r, httptest.NewRequest("GET", "/users", nil))
+	if second.Header().Get("X-Cache") != "HIT" || second.Header().Get("X-Handler") != "users" {
+		t.Fatalf("expect a cache hit with handler headers, got %v", second.Header())
+	}
+	// 命中缓存时还是这个请求自己的 X-Request-ID
+	if id := second.Header().Get("X-Request-ID"); id == "" || id == first.Header().Get("X-Request-ID") {
+		t.Fatalf("expect a new request id on cache hit, got %q", id)
+	}
+}
+
+func TestResponseCache_Shared(t *testing.T) {
+	r := New()
+	r.Use(NewResponseCache(CacheConfig{}).Middleware())
+	r.Host("{tenant}.example.com").GET("/home", func(c *Context) {
+		c.String(http.StatusOK, "home of %s", c.Param("tenant"))
+	})
+	r.GET("/me", func(c *Context) {
+		if c.Req.Header.Get("Authorization") == "" {
+			c.String(http.StatusOK, "anonymous")
+			return
+		}
+		c.String(http.StatusOK, "alice")
+	})
+	r.GET("/public", func(c *Context) {
+		c.SetHeader("Cache-Control", "public, max-age=60")
+		c.String(http.StatusOK, "public")
+	})
+	r.GET("/vary", func(c *Context) {
+		c.SetHeader("Vary", "Accept-Language")
+		c.String(http.StatusOK, "%s", c.Req.Header.Get("Accept-Language"))
+	})
+	r.GET("/vary-all", func(c *Context) {
+		c.SetHeader("Vary", "*")
+		c.String(http.StatusOK, "any")
+	})
+	get := func(host string, path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Host = host
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		return serve(r, req)
+	}
+
+	// 不同的 host 分开缓存
+	get("a.example.com", "/home")
+	if w := get("b.example.com", "/home"); w.Body.String() != "home of b" || w.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("expect a separate entry per host, got %q %s", w.Body.String(), w.Header().Get("X-Cache"))
+	}
+
+	// 带 Authorization 的响应不能给别的请求用
+	get("example.com", "/me", "Authorization", "Bearer alice")
+	if w := get("example.com", "/me"); w.Body.String() != "anonymous" {
+		t.Fatalf("expect authorized response not to be shared, got %q", w.Body.String())
+	}
+	get("example.com", "/public", "Authorization", "Bearer alice")
+	if w := get("example.com", "/public"); w.Header().Get("X-Cache") != "HIT" {
+		t.Fatal("expect public response to an authorized request to be cached")
+	}
+
+	// 响应的 Vary 不一样时不命中，Vary: * 不缓存
+	get("example.com", "/vary", "Accept-Language", "en")
+	if w := get("example.com", "/vary", "Accept-Language", "zh"); w.Body.String() != "zh" {
+		t.Fatalf("expect Vary to separate responses, got %q", w.Body.String())
+	}
+	if w := get("example.com", "/vary", "Accept-Language", "zh"); w.Header().Get("X-Cache") != "HIT" {
+		t.Fatal("expect the same Accept-Language to hit")
+	}
+	get("example.com", "/vary-all")
+	if w := get("example.com", "/vary-all"); w.Header().Get("X-Cache") != "MISS" {
+		t.Fatal("expect Vary: * not to be cached")
+	}
+}
+
+func TestBufferWriter_Flush(t *testing.T) {
+	cache := NewResponseCache(CacheConfig{})
+	r := New()
+	r.Use(ETag(), cache.Middleware())
+	r.GET("/stream", func(c *Context) {
+		w := c.NDJSON(http.StatusOK)
+		_ = w.Encode(H{"n": 1})
+		_ = w.Encode(H{"n": 2})
+	})
+
+	w := serve(r, httptest.NewRequest("GET", "/stream", nil))
+	if !w.Flushed || w.Body.String() != "{\"n\":1}\n{\"n\":2}\n" {
+		t.Fatalf("expect flushed stream, got flushed=%v %q", w.Flushed, w.Body.String())
+	}
+	if w.Header().Get("ETag") != "" || cache.Len() != 0 {
+		t.Fatalf("streamed response should not get an etag or be cached")
+	}
+}
@@ -0,0 +1,154 @@
+package pee
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Client 调用其他 pee 服务的客户端。
+// 路由和服务端共用同一份定义：服务端和客户端都用同一个函数注册命名路由，
+// 客户端按路由名生成请求，有 RouteDoc 时还会检查请求和响应的类型，改了服务端编译或者调用时就能发现
+type Client struct {
+	BaseURL    string       // 例如 http://user-service:9999
+	HTTPClient *http.Client // 为 nil 时用 http.DefaultClient
+	Header     http.Header  // 每个请求都带上的请求头
+
+	engine *Engine
+}
+
+// NewClient 用 engine 里的命名路由创建客户端，engine 可以只注册路由不设置 handler
+func NewClient(baseURL string, engine *Engine) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Header:  make(http.Header),
+		engine:  engine,
+	}
+}
+
+// ClientError 服务端返回了 4xx、5xx
+type ClientError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *ClientError) Error() string {
+	return fmt.Sprintf("pee: server returned %d: %s", e.StatusCode, bytes.TrimSpace(e.Body))
+}
+
+// Call 调用名为 name 的路由，pairs 是路径参数和 query 参数，和 Engine.URL 一样。
+// in 不为 nil 时编码成 JSON 请求体，out 不为 nil 时把 2xx 的响应解码进去，
+// 请求的 context 里有 Span 时带上 traceparent
+func (c *Client) Call(ctx context.Context, name string, in interface{}, out interface{}, pairs ...interface{}) error {
+	rt := c.engine.router.Load()
+	route, ok := rt.names[name]
+	if !ok {
+		return fmt.Errorf("pee: unknown route %q", name)
+	}
+	if err := checkDoc(name, rt.meta[route].doc, in, out); err != nil {
+		return err
+	}
+	codec := c.engine.json
+
+	var body io.Reader
+	if in != nil {
+		buf := new(bytes.Buffer)
+		if err := codec.NewEncoder(buf).Encode(in); err != nil {
+			return err
+		}
+		body = buf
+	}
+	req, err := http.NewRequestWithContext(ctx, route.Method, c.BaseURL+route.buildURL(pairs...), body)
+	if err != nil {
+		return err
+	}
+	for key, values := range c.Header {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if route.Host != "" && !strings.ContainsAny(route.Host, "{*") {
+		req.Host = route.Host
+	}
+	InjectTraceparent(ctx, req.Header)
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return &ClientError{StatusCode: resp.StatusCode, Body: data}
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return codec.NewDecoder(resp.Body).Decode(out)
+}
+
+// 路由写了 RouteDoc 时，请求和响应的类型要和文档一致
+func checkDoc(name string, doc *RouteDoc, in interface{}, out interface{}) error {
+	if doc == nil {
+		return nil
+	}
+	if in != nil && doc.Request != nil && !sameType(in, doc.Request) {
+		return fmt.Errorf("pee: route %q expects request %T, got %T", name, doc.Request, in)
+	}
+	if out == nil {
+		return nil
+	}
+	for code, resp := range doc.Responses {
+		if code >= 200 && code < 300 && resp != nil && !sameType(out, resp) {
+			return fmt.Errorf("pee: route %q responds with %T, got %T", name, resp, out)
+		}
+	}
+	return nil
+}
+
+// 去掉指针之后类型相同
+func sameType(a interface{}, b interface{}) bool {
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	for ta.Kind() == reflect.Ptr {
+		ta = ta.Elem()
+	}
+	for tb.Kind() == reflect.Ptr {
+		tb = tb.Elem()
+	}
+	return ta == tb
+}
+
+// Endpoint 一个路由的类型化客户端，例如
+//
+//	showUser := pee.NewEndpoint[struct{}, User](client, "user.show")
+//	user, err := showUser.Call(ctx, struct{}{}, "id", 42)
+type Endpoint[Req any, Resp any] struct {
+	client *Client
+	name   string
+}
+
+// NewEndpoint 创建类型化的客户端
+func NewEndpoint[Req any, Resp any](client *Client, name string) Endpoint[Req, Resp] {
+	return Endpoint[Req, Resp]{client: client, name: name}
+}
+
+// Call 调用接口，Req 是 struct{} 时不发送请求体
+func (e Endpoint[Req, Resp]) Call(ctx context.Context, req Req, pairs ...interface{}) (Resp, error) {
+	var resp Resp
+	var in interface{} = req
+	if reflect.TypeOf(req) == reflect.TypeOf(struct{}{}) {
+		in = nil
+	}
+	err := e.client.Call(ctx, e.name, in, &resp, pairs...)
+	return resp, err
+}
@@ -0,0 +1,74 @@
+package pee
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type clientUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type userHandlers struct {
+	show, create HandlerFunc
+}
+
+// 服务端和客户端共用的路由定义
+func registerUserRoutes(g *RouterGroup, h userHandlers) {
+	g.GET("/users/{id:int}", h.show).Name("user.show").Doc(RouteDoc{Responses: map[int]interface{}{200: clientUser{}}})
+	g.POST("/users", h.create).Name("user.create").Doc(RouteDoc{Request: clientUser{}, Responses: map[int]interface{}{201: clientUser{}}})
+}
+
+func TestClient(t *testing.T) {
+	server := New(WithMode(TestMode))
+	registerUserRoutes(server.Group("/api"), userHandlers{
+		show: func(c *Context) {
+			id, _ := c.ParamInt("id")
+			if id == 0 {
+				c.Fail(http.StatusNotFound, "user not found")
+				return
+			}
+			c.JSON(http.StatusOK, clientUser{ID: id, Name: c.Query("name")})
+		},
+		create: func(c *Context) {
+			var u clientUser
+			if err := c.DecodeJSON(&u); err != nil {
+				c.Fail(http.StatusBadRequest, err.Error())
+				return
+			}
+			u.ID = 7
+			c.JSON(http.StatusCreated, u)
+		},
+	})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	routes := New(WithMode(TestMode))
+	registerUserRoutes(routes.Group("/api"), userHandlers{})
+	client := NewClient(ts.URL, routes)
+	ctx := context.Background()
+
+	user, err := NewEndpoint[struct{}, clientUser](client, "user.show").Call(ctx, struct{}{}, "id", 42, "name", "lzj")
+	if err != nil || user != (clientUser{ID: 42, Name: "lzj"}) {
+		t.Fatalf("unexpected user %+v, %v", user, err)
+	}
+	created, err := NewEndpoint[clientUser, clientUser](client, "user.create").Call(ctx, clientUser{Name: "pee"})
+	if err != nil || created.ID != 7 || created.Name != "pee" {
+		t.Fatalf("unexpected user %+v, %v", created, err)
+	}
+
+	var clientErr *ClientError
+	if err := client.Call(ctx, "user.show", nil, &user, "id", 0); !errors.As(err, &clientErr) || clientErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expect a 404 ClientError, got %v", err)
+	}
+	if err := client.Call(ctx, "user.create", H{"name": "pee"}, &user); err == nil {
+		t.Fatal("expect an error for a request type that differs from the route doc")
+	}
+	if err := client.Call(ctx, "user.delete", nil, nil); err == nil {
+		t.Fatal("expect an error for an unknown route")
+	}
+}
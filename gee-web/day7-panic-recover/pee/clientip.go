@@ -0,0 +1,189 @@
+package pee
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// SetTrustedProxies 设置可信代理，可以是 CIDR 或者单个 IP。
+// 只有请求来自可信代理时，ClientIP 才会使用 SetRemoteIPHeaders 设置的请求头。服务运行时也可以调用
+func (e *Engine) SetTrustedProxies(proxies []string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("pee: invalid trusted proxy %q", proxy)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			proxy = fmt.Sprintf("%s/%d", proxy, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("pee: invalid trusted proxy %q: %v", proxy, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	e.trustedProxies.Store(&nets)
+	return nil
+}
+
+// defaultRemoteIPHeaders ClientIP 默认读取的请求头。
+// Forwarded 默认不读，只追加 X-Forwarded-For 的代理会把客户端伪造的 Forwarded 原样转发
+var defaultRemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
+// SetRemoteIPHeaders 设置请求来自可信代理时 ClientIP 按顺序读取的请求头，默认 X-Forwarded-For、X-Real-IP。
+// 只写代理会覆盖或者追加的请求头，代理是 RFC 7239 的实现时可以加上 Forwarded。服务运行时也可以调用
+func (e *Engine) SetRemoteIPHeaders(headers ...string) {
+	canonical := make([]string, len(headers))
+	for i, header := range headers {
+		canonical[i] = http.CanonicalHeaderKey(header)
+	}
+	e.remoteIPHeaders.Store(&canonical)
+}
+
+// 是否是可信代理
+func (e *Engine) isTrustedProxy(ip net.IP) bool {
+	proxies := e.trustedProxies.Load()
+	if proxies == nil {
+		return false
+	}
+	for _, ipNet := range *proxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析 ip、ip:port、[ipv6]:port
+func parseIP(s string) net.IP {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	return net.ParseIP(strings.Trim(s, "[]"))
+}
+
+// 解析 Forwarded 请求头里的 for 参数，按出现顺序返回，例如 for=192.0.2.60;proto=http, for="[2001:db8::1]:4711"
+func forwardedFor(header string) []string {
+	var addrs []string
+	for _, element := range strings.Split(header, ",") {
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				addrs = append(addrs, value)
+			}
+		}
+	}
+	return addrs
+}
+
+// ClientIP 返回真实的客户端IP。请求直接来自可信代理时，按 SetRemoteIPHeaders 的顺序读取请求头，
+// 从右往左跳过可信代理，第一个不可信的地址就是客户端
+func (c *Context) ClientIP() string {
+	remote := parseIP(c.Req.RemoteAddr)
+	if remote == nil {
+		return ""
+	}
+	if c.engine == nil || !c.engine.isTrustedProxy(remote) {
+		return remote.String()
+	}
+
+	headers := defaultRemoteIPHeaders
+	if h := c.engine.remoteIPHeaders.Load(); h != nil {
+		headers = *h
+	}
+	for _, header := range headers {
+		// 同一个请求头可能有多行，都要算上
+		values := strings.Join(c.Req.Header.Values(header), ",")
+		if values == "" {
+			continue
+		}
+		chain := strings.Split(values, ",")
+		if header == "Forwarded" {
+			chain = forwardedFor(values)
+		}
+		if len(chain) == 0 {
+			continue
+		}
+		var ip net.IP
+		for i := len(chain) - 1; i >= 0; i-- {
+			ip = parseIP(chain[i])
+			if ip == nil {
+				// 无法解析的地址，比如 for=unknown，后面的地址都不可信
+				break
+			}
+			if !c.engine.isTrustedProxy(ip) {
+				return ip.String()
+			}
+		}
+		if ip != nil {
+			// 全都是可信代理，取最左边的地址
+			return ip.String()
+		}
+	}
+	return remote.String()
+}
+
+const requestIDKey = "pee.request_id"
+
+// RequestIDConfig RequestID 中间件的配置
+type RequestIDConfig struct {
+	Header    string        // 默认 X-Request-ID
+	Generator func() string // 默认生成32位的十六进制随机字符串
+}
+
+// RequestID 沿用请求里的 X-Request-ID 或者生成一个新的，并写入响应头
+func RequestID() HandlerFunc {
+	return RequestIDWithConfig(RequestIDConfig{})
+}
+
+// RequestIDWithConfig 可以自定义请求头和生成方式的 RequestID
+func RequestIDWithConfig(conf RequestIDConfig) HandlerFunc {
+	if conf.Header == "" {
+		conf.Header = "X-Request-ID"
+	}
+	if conf.Generator == nil {
+		conf.Generator = func() string {
+			var b [16]byte
+			_, _ = rand.Read(b[:])
+			return hex.EncodeToString(b[:])
+		}
+	}
+	return func(c *Context) {
+		id := c.Req.Header.Get(conf.Header)
+		if !validRequestID(id) {
+			id = conf.Generator()
+		}
+		c.Set(requestIDKey, id)
+		c.SetHeader(conf.Header, id)
+		c.Next()
+	}
+}
+
+// 只接受不太长的可打印字符，避免把奇怪的内容写进日志和响应头
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID 返回 RequestID 中间件设置的请求ID
+func (c *Context) RequestID() string {
+	id, _ := c.Keys[requestIDKey].(string)
+	return id
+}
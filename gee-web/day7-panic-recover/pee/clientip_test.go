@@ -0,0 +1,77 @@
+package pee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	r := New()
+	if err := r.SetTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Fatal("expect an error for invalid proxy")
+	}
+
+	forwarded := `for="[2001:db8::1]:4711";proto=https, for=10.0.0.5`
+	cases := []struct {
+		remote string
+		header http.Header
+		want   string
+	}{
+		{"203.0.113.9:1234", http.Header{"X-Forwarded-For": {"1.1.1.1"}}, "203.0.113.9"},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"6.6.6.6, 1.1.1.1, 10.0.0.2"}}, "1.1.1.1"},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"10.0.0.3, 192.168.1.1"}}, "10.0.0.3"},
+		// 多行的 X-Forwarded-For 都要算上
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"6.6.6.6", "1.1.1.1, 10.0.0.2"}}, "1.1.1.1"},
+		// 默认不读 Forwarded，客户端自己带上的 Forwarded 不能决定 IP
+		{"10.0.0.1:1234", http.Header{"Forwarded": {"for=1.2.3.4"}, "X-Forwarded-For": {"5.5.5.5"}}, "5.5.5.5"},
+		{"192.168.1.1:1234", http.Header{"Forwarded": {forwarded}}, "192.168.1.1"},
+		{"10.0.0.1:1234", http.Header{"X-Real-Ip": {"2.2.2.2"}}, "2.2.2.2"},
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+	}
+	check := func(remote string, header http.Header, want string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remote
+		req.Header = header
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+		c := newContext(httptest.NewRecorder(), req)
+		c.engine = r
+		if got := c.ClientIP(); got != want {
+			t.Fatalf("%s %v: expect %s, got %s", remote, header, want, got)
+		}
+	}
+	for _, tc := range cases {
+		check(tc.remote, tc.header, tc.want)
+	}
+
+	// 代理实现了 Forwarded 时可以配置成优先读取
+	r.SetRemoteIPHeaders("forwarded", "X-Forwarded-For")
+	check("192.168.1.1:1234", http.Header{"Forwarded": {forwarded}}, "2001:db8::1")
+	check("10.0.0.1:1234", http.Header{"X-Real-Ip": {"2.2.2.2"}}, "10.0.0.1")
+}
+
+func TestRequestID(t *testing.T) {
+	r := New()
+	r.Use(RequestID())
+	var id string
+	r.GET("/", func(c *Context) {
+		id = c.RequestID()
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := serve(r, httptest.NewRequest("GET", "/", nil))
+	if len(id) != 32 || w.Header().Get("X-Request-ID") != id {
+		t.Fatalf("expect a generated request id, got %q", id)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "upstream-id")
+	if w := serve(r, req); w.Header().Get("X-Request-ID") != "upstream-id" || id != "upstream-id" {
+		t.Fatalf("expect the upstream request id to be kept, got %q", id)
+	}
+}
@@ -0,0 +1,212 @@
+package pee
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// 运行模式
+const (
+	DebugMode   = "debug"   // 打印注册的路由
+	ReleaseMode = "release" // 不打印调试信息
+	TestMode    = "test"    // 不打印调试信息，默认的日志也丢弃
+)
+
+// EnvMode 环境变量，New 时用它设置运行模式，没有设置时是 debug
+const EnvMode = "PEE_MODE"
+
+// LogPrinter 引擎输出日志用的接口，*log.Logger 就实现了它
+type LogPrinter interface {
+	Printf(format string, v ...interface{})
+}
+
+// JSONEncoder 把值编码成 JSON 写出去
+type JSONEncoder interface {
+	Encode(v interface{}) error
+}
+
+// JSONDecoder 从输入里读出 JSON 值
+type JSONDecoder interface {
+	Decode(v interface{}) error
+}
+
+// JSONCodec 可以替换的 JSON 实现，默认使用 encoding/json
+type JSONCodec interface {
+	NewEncoder(w io.Writer) JSONEncoder
+	NewDecoder(r io.Reader) JSONDecoder
+}
+
+type stdJSON struct{}
+
+func (stdJSON) NewEncoder(w io.Writer) JSONEncoder { return json.NewEncoder(w) }
+func (stdJSON) NewDecoder(r io.Reader) JSONDecoder { return json.NewDecoder(r) }
+
+// StdJSON 使用 encoding/json 的 JSONCodec
+var StdJSON JSONCodec = stdJSON{}
+
+// Option 创建引擎时的配置，先用默认值，再按顺序应用 Option，没有用 WithMode 时读环境变量
+type Option func(*Engine)
+
+// WithMode 设置运行模式，debug、release 或者 test
+func WithMode(mode string) Option {
+	return func(e *Engine) {
+		e.setMode(mode)
+	}
+}
+
+// WithLogger 设置引擎的日志，注册路由、Logger、Recovery 中间件都会用它
+func WithLogger(logger LogPrinter) Option {
+	return func(e *Engine) {
+		e.logger = logger
+	}
+}
+
+// WithMaxBodySize 限制请求体的大小，超过时返回 413，n <= 0 表示不限制
+func WithMaxBodySize(n int64) Option {
+	return func(e *Engine) {
+		e.maxBodySize = n
+	}
+}
+
+// WithTrustedProxies 设置可信代理，见 SetTrustedProxies，代理格式不对时 panic
+func WithTrustedProxies(proxies ...string) Option {
+	return func(e *Engine) {
+		if err := e.SetTrustedProxies(proxies); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// WithRedirectTrailingSlash 请求的路径和路由只差末尾的 / 时，重定向到和路由一致的路径
+func WithRedirectTrailingSlash(enabled bool) Option {
+	return func(e *Engine) {
+		e.redirectTrailingSlash = enabled
+	}
+}
+
+// WithRedirectFixedPath 请求的路径里有 //、. 或者 .. 时，重定向到清理过的路径
+func WithRedirectFixedPath(enabled bool) Option {
+	return func(e *Engine) {
+		e.redirectFixedPath = enabled
+	}
+}
+
+// WithJSONCodec 替换 JSON 的编码和解码
+func WithJSONCodec(codec JSONCodec) Option {
+	return func(e *Engine) {
+		e.json = codec
+	}
+}
+
+// 设置运行模式，不认识的模式直接 panic
+func (e *Engine) setMode(mode string) {
+	switch mode {
+	case DebugMode, ReleaseMode, TestMode:
+		e.mode = mode
+	default:
+		panic(fmt.Sprintf("pee: unknown mode %q", mode))
+	}
+}
+
+// Mode 返回引擎的运行模式
+func (e *Engine) Mode() string {
+	return e.mode
+}
+
+// 按默认值、Option、环境变量的顺序配置引擎。
+// 环境变量里的模式不认识时不 panic，用 debug 模式并打印警告，避免环境变量写错了进程起不来
+func (e *Engine) configure(opts []Option) {
+	e.json = StdJSON
+	for _, opt := range opts {
+		opt(e)
+	}
+	var badEnv string
+	if e.mode == "" {
+		e.mode = DebugMode
+		switch mode := os.Getenv(EnvMode); mode {
+		case "":
+		case DebugMode, ReleaseMode, TestMode:
+			e.mode = mode
+		default:
+			badEnv = mode
+		}
+	}
+	if e.logger == nil {
+		if e.mode == TestMode {
+			e.logger = log.New(io.Discard, "", 0)
+		} else {
+			e.logger = log.Default()
+		}
+	}
+	if badEnv != "" {
+		e.logger.Printf("[pee-warning] unknown %s %q, using %s mode", EnvMode, badEnv, DebugMode)
+	}
+}
+
+// 只在 debug 模式下打印
+func (e *Engine) debugPrintf(format string, v ...interface{}) {
+	if e.mode == DebugMode {
+		e.logger.Printf("[pee-debug] "+format, v...)
+	}
+}
+
+// 需要重定向时返回新的地址，route 是用请求原来的路径在 rt 上找到的路由，
+// 路径不需要清理时直接用它，不再查找一遍
+func (e *Engine) redirectURL(rt *router, req *http.Request, route *Route) (string, bool) {
+	if !e.redirectTrailingSlash && !e.redirectFixedPath {
+		return "", false
+	}
+	target := req.URL.Path
+	if e.redirectFixedPath {
+		target = cleanPath(target)
+	}
+	u := *req.URL
+	u.Path, u.RawPath = target, ""
+	if target != req.URL.Path {
+		r := *req
+		r.URL = &u
+		route, _ = rt.route(&r)
+	}
+	if route == nil {
+		return "", false
+	}
+	if e.redirectTrailingSlash {
+		target = matchTrailingSlash(target, route.Pattern)
+	}
+	if target == req.URL.Path {
+		return "", false
+	}
+	u.Path = target
+	return u.RequestURI(), true
+}
+
+// path.Clean 会去掉末尾的 /，这里保留下来交给 matchTrailingSlash 处理
+func cleanPath(p string) string {
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// 让路径末尾的 / 和路由一致，通配路由不处理
+func matchTrailingSlash(p string, pattern string) string {
+	parts := parsePatten(pattern)
+	if p == "/" || len(parts) == 0 || parts[len(parts)-1][0] == '*' {
+		return p
+	}
+	want, has := strings.HasSuffix(pattern, "/"), strings.HasSuffix(p, "/")
+	switch {
+	case want && !has:
+		return p + "/"
+	case !want && has:
+		return strings.TrimRight(p, "/")
+	}
+	return p
+}
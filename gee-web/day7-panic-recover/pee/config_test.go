@@ -0,0 +1,125 @@
+package pee
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEngineMode(t *testing.T) {
+	t.Setenv(EnvMode, ReleaseMode)
+	if mode := New().Mode(); mode != ReleaseMode {
+		t.Fatalf("expect mode from env, got %s", mode)
+	}
+	if mode := New(WithMode(TestMode)).Mode(); mode != TestMode {
+		t.Fatalf("option should override env, got %s", mode)
+	}
+
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+	New(WithMode(ReleaseMode), WithLogger(logger)).GET("/hello", nil)
+	if buf.Len() != 0 {
+		t.Fatalf("release mode should not print routes, got %q", buf.String())
+	}
+	New(WithMode(DebugMode), WithLogger(logger)).GET("/hello", nil)
+	if !strings.Contains(buf.String(), "Route  GET - /hello") {
+		t.Fatalf("debug mode should print routes, got %q", buf.String())
+	}
+
+	// 环境变量写错了不 panic，用 debug 模式并打印警告
+	t.Setenv(EnvMode, "prod")
+	if mode := New(WithMode(ReleaseMode)).Mode(); mode != ReleaseMode {
+		t.Fatalf("option should ignore a bad env, got %s", mode)
+	}
+	buf.Reset()
+	if mode := New(WithLogger(logger)).Mode(); mode != DebugMode || !strings.Contains(buf.String(), `unknown PEE_MODE "prod"`) {
+		t.Fatalf("expect debug mode with a warning, got %s %q", mode, buf.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expect panic for unknown mode")
+		}
+	}()
+	New(WithMode("production"))
+}
+
+func TestMaxBodySize(t *testing.T) {
+	r := New(WithMode(TestMode), WithMaxBodySize(4))
+	r.POST("/", func(c *Context) {
+		if _, err := io.ReadAll(c.Req.Body); err != nil {
+			c.String(http.StatusRequestEntityTooLarge, "%s", err)
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	if w := serve(r, httptest.NewRequest("POST", "/", strings.NewReader("12345"))); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expect 413 from Content-Length, got %d", w.Code)
+	}
+	req := httptest.NewRequest("POST", "/", strings.NewReader("12345"))
+	req.ContentLength = -1
+	if w := serve(r, req); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expect 413 while reading, got %d", w.Code)
+	}
+	if w := serve(r, httptest.NewRequest("POST", "/", strings.NewReader("1234"))); w.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d", w.Code)
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	r := New(WithMode(TestMode), WithRedirectTrailingSlash(true), WithRedirectFixedPath(true))
+	r.GET("/users/:id", func(c *Context) { c.String(http.StatusOK, "%s", c.Param("id")) })
+	r.GET("/docs/", func(c *Context) { c.String(http.StatusOK, "docs") })
+	r.POST("/users", func(c *Context) { c.String(http.StatusOK, "created") })
+	r.GET("/assets/*filepath", func(c *Context) { c.String(http.StatusOK, "%s", c.Param("filepath")) })
+
+	cases := []struct {
+		method, path string
+		code         int
+		location     string
+	}{
+		{"GET", "/users/1", http.StatusOK, ""},
+		{"GET", "/users/1/?a=b", http.StatusMovedPermanently, "/users/1?a=b"},
+		{"GET", "/docs", http.StatusMovedPermanently, "/docs/"},
+		{"POST", "/users/", http.StatusPermanentRedirect, "/users"},
+		{"GET", "/a/../users//2", http.StatusMovedPermanently, "/users/2"},
+		{"GET", "/assets/css/", http.StatusOK, ""},
+		{"GET", "/missing/", http.StatusNotFound, ""},
+	}
+	for _, c := range cases {
+		w := serve(r, httptest.NewRequest(c.method, c.path, nil))
+		if w.Code != c.code || w.Header().Get("Location") != c.location {
+			t.Fatalf("%s %s: expect %d %q, got %d %q", c.method, c.path, c.code, c.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+type upperJSON struct{}
+
+type upperEncoder struct{ w io.Writer }
+
+func (e upperEncoder) Encode(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(e.w, strings.ToUpper(string(data)))
+	return err
+}
+
+func (upperJSON) NewEncoder(w io.Writer) JSONEncoder { return upperEncoder{w} }
+func (upperJSON) NewDecoder(r io.Reader) JSONDecoder { return json.NewDecoder(r) }
+
+func TestJSONCodec(t *testing.T) {
+	r := New(WithMode(TestMode), WithJSONCodec(upperJSON{}))
+	r.GET("/", func(c *Context) { c.JSON(http.StatusOK, H{"name": "lzj"}) })
+	if body := serve(r, httptest.NewRequest("GET", "/", nil)).Body.String(); body != "{\"NAME\":\"LZJ\"}\n" {
+		t.Fatalf("expect custom codec output, got %q", body)
+	}
+}
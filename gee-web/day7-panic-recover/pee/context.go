@@ -1,9 +1,9 @@
 package pee
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 )
 
 type H map[string]interface{}
@@ -13,11 +13,14 @@ type Context struct {
 	Writer http.ResponseWriter
 	Req    *http.Request
 	// request信息
-	Path   string
-	Method string
-	Params map[string]string
+	Path    string
+	Method  string
+	Params  map[string]string
+	Pattern string // 匹配到的路由，例如 /users/:id，没有匹配到时为空
 	// response信息
 	StatusCode int
+	// 中间件之间共享的数据
+	Keys map[string]interface{}
 	// 中间件
 	handlers []HandlerFunc
 	index    int
@@ -31,6 +34,45 @@ func (c *Context) Param(key string) string {
 	return value
 }
 
+// 保存一个只在这次请求里使用的值
+func (c *Context) Set(key string, value interface{}) {
+	if c.Keys == nil {
+		c.Keys = make(map[string]interface{})
+	}
+	c.Keys[key] = value
+}
+
+// 获取Set保存的值
+func (c *Context) Get(key string) (value interface{}, exists bool) {
+	value, exists = c.Keys[key]
+	return
+}
+
+// 把Params对应的value转成int，适合 /users/{id:int} 这样的路由
+func (c *Context) ParamInt(key string) (int, error) {
+	return strconv.Atoi(c.Param(key))
+}
+
+// 把Params对应的value转成int64
+func (c *Context) ParamInt64(key string) (int64, error) {
+	return strconv.ParseInt(c.Param(key), 10, 64)
+}
+
+// 把Params对应的value转成uint64
+func (c *Context) ParamUint64(key string) (uint64, error) {
+	return strconv.ParseUint(c.Param(key), 10, 64)
+}
+
+// 把Params对应的value转成float64
+func (c *Context) ParamFloat64(key string) (float64, error) {
+	return strconv.ParseFloat(c.Param(key), 64)
+}
+
+// 把Params对应的value转成bool
+func (c *Context) ParamBool(key string) (bool, error) {
+	return strconv.ParseBool(c.Param(key))
+}
+
 // 返回一个ServerHTTP的上下文
 func newContext(w http.ResponseWriter, req *http.Request) *Context {
 	return &Context{
@@ -42,12 +84,25 @@ func newContext(w http.ResponseWriter, req *http.Request) *Context {
 	}
 }
 
+// CreateTestContext 不启动服务直接创建一个上下文，用来单独测试中间件，调用 c.Next() 开始执行 handlers
+func CreateTestContext(w http.ResponseWriter, req *http.Request, handlers ...HandlerFunc) *Context {
+	c := newContext(w, req)
+	c.handlers = handlers
+	c.engine = New()
+	return c
+}
+
 func (c *Context) Fail(code int, err string) {
-	c.index = len(c.handlers)
+	c.Abort()
 	// 这里是
 	c.JSON(code, H{"message": err})
 }
 
+// 跳过后面还没执行的中间件和handler
+func (c *Context) Abort() {
+	c.index = len(c.handlers)
+}
+
 func (c *Context) Next() {
 	c.index++ // 当前执行到第几个中间件
 	s := len(c.handlers)
@@ -84,14 +139,27 @@ func (c *Context) String(code int, format string, values ...interface{}) {
 	c.Writer.Write([]byte(fmt.Sprintf(format, values...)))
 }
 
-// 写入json格式数据
+// 写入json格式数据，先编码到缓冲区，编码失败时还能返回干净的 500
 func (c *Context) JSON(code int, obj interface{}) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := c.jsonCodec().NewEncoder(buf).Encode(obj); err != nil {
+		// 错误里有内部的类型和值，只写进日志，不返回给客户端
+		if c.engine != nil {
+			c.engine.logger.Printf("pee: encode json for %s: %v", c.Path, err)
+		}
+		c.String(http.StatusInternalServerError, "500 Internal Server Error\n")
+		return
+	}
 	c.SetHeader("Content-type", "application/json")
 	c.Status(code)
-	encoder := json.NewEncoder(c.Writer)
-	if err := encoder.Encode(obj); err != nil {
-		http.Error(c.Writer, err.Error(), 500)
-	}
+	c.Writer.Write(buf.Bytes())
+}
+
+// 重定向到 location
+func (c *Context) Redirect(code int, location string) {
+	c.StatusCode = code
+	http.Redirect(c.Writer, c.Req, location, code)
 }
 
 // 写入数据
@@ -102,9 +170,19 @@ func (c *Context) Data(code int, data []byte) {
 
 // 加载模板
 func (c *Context) HTML(code int, name string, data interface{}) {
+	tmpl := c.engine.htmlTemplates
+	if bundle, ok := c.Keys[bundleKey].(*Bundle); ok {
+		// 使用了 I18n 中间件，模板里的 T 要用这次请求的语言
+		t, err := c.engine.localeTemplate(bundle, c.Locale())
+		if err != nil {
+			c.Fail(500, err.Error())
+			return
+		}
+		tmpl = t
+	}
 	c.SetHeader("Content-Type", "text/html")
 	c.Status(code)
-	if err := c.engine.htmlTemplates.ExecuteTemplate(c.Writer, name, data); err != nil {
+	if err := tmpl.ExecuteTemplate(c.Writer, name, data); err != nil {
 		c.Fail(500, err.Error())
 	}
 }
@@ -0,0 +1,114 @@
+package pee
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// hostPattern 按 . 分割的 host，例如 api.example.com 或 {tenant}.example.com
+type hostPattern struct {
+	host     string
+	labels   []string
+	matchers []*regexp.Regexp // {tenant:[a-z]+} 这样的约束
+	wild     bool             // 含有 {} 或 * 时为true
+}
+
+func newHostPattern(host string) *hostPattern {
+	h := &hostPattern{host: host}
+	for _, label := range strings.Split(strings.ToLower(host), ".") {
+		label = normalizePart(label)
+		if label != "" && (label[0] == ':' || label[0] == '{' || label[0] == '*') {
+			h.wild = true
+		}
+		matcher, err := compileConstraint(label)
+		if err != nil {
+			panic(fmt.Sprintf("pee: invalid constraint in %q: %v", host, err))
+		}
+		h.labels = append(h.labels, label)
+		h.matchers = append(h.matchers, matcher)
+	}
+	return h
+}
+
+// 匹配请求的host，返回 {tenant} 这样的参数
+func (h *hostPattern) match(host string) (map[string]string, bool) {
+	labels := strings.Split(host, ".")
+	if len(labels) != len(h.labels) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, label := range h.labels {
+		switch {
+		case label == "*":
+		case label != "" && (label[0] == ':' || label[0] == '{'):
+			if h.matchers[i] != nil && !h.matchers[i].MatchString(labels[i]) {
+				return nil, false
+			}
+			params[paramName(label)] = labels[i]
+		case label != labels[i]:
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// 去掉端口的小写host
+func requestHost(req *http.Request) string {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// Matcher 路由的额外匹配条件，同一个pattern可以按请求头、query选择不同的handler
+type Matcher func(req *http.Request) bool
+
+// MatchHeader 请求头key里有一项等于value时匹配，比如按 Accept 选择 API 版本，value 为 * 时只要求有这个请求头
+func MatchHeader(key string, value string) Matcher {
+	return func(req *http.Request) bool {
+		values := req.Header.Values(key)
+		if value == "*" {
+			return len(values) > 0
+		}
+		for _, v := range values {
+			for _, item := range strings.Split(v, ",") {
+				// 忽略 ;q=0.9 这样的参数
+				item, _, _ = strings.Cut(item, ";")
+				if strings.EqualFold(strings.TrimSpace(item), value) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// MatchQuery query参数key等于value时匹配，value 为 * 时只要求有这个参数
+func MatchQuery(key string, value string) Matcher {
+	return func(req *http.Request) bool {
+		values, ok := req.URL.Query()[key]
+		if value == "*" {
+			return ok
+		}
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// 请求是否满足路由的所有matcher
+func (r *Route) match(req *http.Request) bool {
+	for _, m := range r.matchers {
+		if !m(req) {
+			return false
+		}
+	}
+	return true
+}
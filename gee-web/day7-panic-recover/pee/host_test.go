@@ -0,0 +1,85 @@
+package pee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serve(e *Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	return w
+}
+
+func TestHostRouting(t *testing.T) {
+	r := New()
+	r.GET("/", func(c *Context) { c.String(http.StatusOK, "default") })
+	r.Host("api.example.com").GET("/", func(c *Context) { c.String(http.StatusOK, "api") })
+	tenant := r.Host("{tenant}.example.com")
+	tenant.Use(func(c *Context) { c.SetHeader("X-Tenant", c.Param("tenant")) })
+	tenant.Group("/v1").GET("/", func(c *Context) { c.String(http.StatusOK, "tenant %s", c.Param("tenant")) })
+
+	cases := []struct{ host, path, body, tenant string }{
+		{"api.example.com", "/", "api", ""},
+		{"foo.example.com:8080", "/v1/", "tenant foo", "foo"},
+		// 普通路由处理的请求不执行host分组的中间件，也不带host参数
+		{"foo.example.com", "/", "default", ""},
+		{"example.com", "/", "default", ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.Host = c.host
+		w := serve(r, req)
+		if w.Body.String() != c.body || w.Header().Get("X-Tenant") != c.tenant {
+			t.Fatalf("%s%s: expect %q (tenant %q), got %q (tenant %q)",
+				c.host, c.path, c.body, c.tenant, w.Body.String(), w.Header().Get("X-Tenant"))
+		}
+	}
+}
+
+func TestMatcherRouting(t *testing.T) {
+	r := New()
+	r.GET("/users", func(c *Context) { c.String(http.StatusOK, "v1") })
+	r.Match(MatchHeader("Accept", "application/vnd.pee.v2+json")).GET("/users", func(c *Context) { c.String(http.StatusOK, "v2") })
+	r.Match(MatchQuery("version", "3")).GET("/users", func(c *Context) { c.String(http.StatusOK, "v3") })
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	if body := serve(r, req).Body.String(); body != "v1" {
+		t.Fatalf("expect v1, got %s", body)
+	}
+	req.Header.Set("Accept", "text/html, application/vnd.pee.v2+json;q=0.9")
+	if body := serve(r, req).Body.String(); body != "v2" {
+		t.Fatalf("expect v2, got %s", body)
+	}
+	req = httptest.NewRequest("GET", "/users?version=3", nil)
+	if body := serve(r, req).Body.String(); body != "v3" {
+		t.Fatalf("expect v3, got %s", body)
+	}
+}
+
+func TestMatcherFallback(t *testing.T) {
+	r := New()
+	v2 := r.Match(MatchHeader("X-Version", "2"))
+	v2.GET("/users/new", func(c *Context) { c.String(http.StatusOK, "v2 new") })
+	r.GET("/users/:id", func(c *Context) { c.String(http.StatusOK, "user %s", c.Param("id")) })
+
+	// /users/new 只有带matcher的路由，不满足时回退到 /users/:id
+	req := httptest.NewRequest("GET", "/users/new", nil)
+	if body := serve(r, req).Body.String(); body != "user new" {
+		t.Fatalf("expect fallback to /users/:id, got %q", body)
+	}
+	req.Header.Set("X-Version", "2")
+	if body := serve(r, req).Body.String(); body != "v2 new" {
+		t.Fatalf("expect v2 route, got %q", body)
+	}
+
+	// 同一个分组重复注册时替换原来的路由
+	v2.GET("/users/new", func(c *Context) { c.String(http.StatusOK, "v2 new again") })
+	if body := serve(r, req).Body.String(); body != "v2 new again" {
+		t.Fatalf("expect re-registered route, got %q", body)
+	}
+	if n := len(r.Routes()); n != 2 {
+		t.Fatalf("expect 2 routes after re-registering, got %d", n)
+	}
+}
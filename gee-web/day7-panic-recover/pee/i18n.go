@@ -0,0 +1,426 @@
+package pee
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PluralRule 根据数量返回复数类别：zero、one、two、few、many、other
+type PluralRule func(n int) string
+
+// 内置的复数规则，没有注册的语言按 other 处理
+var pluralRules = map[string]PluralRule{
+	"en": func(n int) string {
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	},
+	"fr": func(n int) string {
+		if n == 0 || n == 1 {
+			return "one"
+		}
+		return "other"
+	},
+	"ru": func(n int) string {
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		}
+		return "many"
+	},
+}
+
+// Message 一条翻译，没有复数形式时只用 Other
+type Message struct {
+	Zero, One, Two, Few, Many, Other string
+}
+
+func (m Message) form(category string) string {
+	var s string
+	switch category {
+	case "zero":
+		s = m.Zero
+	case "one":
+		s = m.One
+	case "two":
+		s = m.Two
+	case "few":
+		s = m.Few
+	case "many":
+		s = m.Many
+	}
+	if s == "" {
+		s = m.Other
+	}
+	return s
+}
+
+// Bundle 所有语言的翻译
+type Bundle struct {
+	DefaultLang string // 找不到翻译时使用的语言
+	QueryParam  string // 从这个 query 参数读取语言，默认 lang
+	CookieName  string // 从这个 cookie 读取语言，默认 lang
+
+	messages map[string]map[string]Message
+	rules    map[string]PluralRule
+}
+
+// NewBundle 创建翻译包
+func NewBundle(defaultLang string) *Bundle {
+	return &Bundle{
+		DefaultLang: defaultLang,
+		QueryParam:  "lang",
+		CookieName:  "lang",
+		messages:    make(map[string]map[string]Message),
+		rules:       make(map[string]PluralRule),
+	}
+}
+
+// RegisterPluralRule 注册或者覆盖某个语言的复数规则
+func (b *Bundle) RegisterPluralRule(lang string, rule PluralRule) {
+	b.rules[strings.ToLower(lang)] = rule
+}
+
+// AddMessages 添加一种语言的翻译
+func (b *Bundle) AddMessages(lang string, messages map[string]Message) {
+	lang = strings.ToLower(lang)
+	if b.messages[lang] == nil {
+		b.messages[lang] = make(map[string]Message)
+	}
+	for key, msg := range messages {
+		b.messages[lang][key] = msg
+	}
+}
+
+// LoadFile 加载 JSON 或 TOML 格式的翻译文件，文件名就是语言，例如 zh-CN.json、en.toml。
+// 值是字符串，或者包含 one、other 等复数形式的对象
+func (b *Bundle) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	ext := filepath.Ext(path)
+	raw := make(map[string]interface{})
+	switch ext {
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	case ".toml":
+		raw, err = parseTOML(data)
+	default:
+		err = fmt.Errorf("unsupported format %q", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("pee: load %s: %v", path, err)
+	}
+	messages := make(map[string]Message)
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			messages[key] = Message{Other: v}
+		case map[string]interface{}:
+			var msg Message
+			fields := map[string]*string{"zero": &msg.Zero, "one": &msg.One, "two": &msg.Two, "few": &msg.Few, "many": &msg.Many, "other": &msg.Other}
+			for form, text := range v {
+				field, ok := fields[form]
+				s, isString := text.(string)
+				if !ok || !isString {
+					return fmt.Errorf("pee: load %s: invalid plural form %s.%s", path, key, form)
+				}
+				*field = s
+			}
+			messages[key] = msg
+		default:
+			return fmt.Errorf("pee: load %s: invalid message %s", path, key)
+		}
+	}
+	b.AddMessages(strings.TrimSuffix(filepath.Base(path), ext), messages)
+	return nil
+}
+
+// LoadDir 加载目录下所有的 .json 和 .toml 翻译文件
+func (b *Bundle) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".json" && ext != ".toml") {
+			continue
+		}
+		if err := b.LoadFile(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// match 找到支持的语言，zh-CN 找不到时退回 zh，返回空字符串表示不支持
+func (b *Bundle) match(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "" {
+		return ""
+	}
+	if _, ok := b.messages[lang]; ok {
+		return lang
+	}
+	base, _, _ := strings.Cut(lang, "-")
+	if _, ok := b.messages[base]; ok {
+		return base
+	}
+	return ""
+}
+
+// pluralRule 先找完整的语言，再找基础语言
+func (b *Bundle) pluralRule(lang string) PluralRule {
+	base, _, _ := strings.Cut(lang, "-")
+	for _, rules := range []map[string]PluralRule{b.rules, pluralRules} {
+		if rule, ok := rules[lang]; ok {
+			return rule
+		}
+		if rule, ok := rules[base]; ok {
+			return rule
+		}
+	}
+	return func(int) string { return "other" }
+}
+
+// 整数参数的值，第一个参数是整数时用来选择复数形式
+func pluralCount(args []interface{}) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	v := reflect.ValueOf(args[0])
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint()), true
+	}
+	return 0, false
+}
+
+// 是否含有 fmt 的格式化动词，%% 不算
+func hasVerb(text string) bool {
+	for i := 0; i < len(text)-1; i++ {
+		if text[i] == '%' {
+			if text[i+1] != '%' {
+				return true
+			}
+			i++
+		}
+	}
+	return false
+}
+
+// T 翻译 key，args 会用 fmt.Sprintf 格式化进翻译，第一个参数是整数时按复数规则选择形式。
+// 找不到翻译时依次尝试基础语言和默认语言，都没有时返回 key
+func (b *Bundle) T(lang string, key string, args ...interface{}) string {
+	for _, l := range []string{b.match(lang), b.match(b.DefaultLang)} {
+		msg, ok := b.messages[l][key]
+		if !ok {
+			continue
+		}
+		category := "other"
+		if n, ok := pluralCount(args); ok {
+			category = b.pluralRule(l)(n)
+		}
+		text := msg.form(category)
+		// one = "one item" 这样没有格式化动词的形式，参数只用来选择复数形式
+		if len(args) > 0 && hasVerb(text) {
+			return fmt.Sprintf(text, args...)
+		}
+		return text
+	}
+	return key
+}
+
+// Detect 按 query 参数、cookie、Accept-Language 的顺序检测语言，都不支持时返回默认语言
+func (b *Bundle) Detect(req *http.Request) string {
+	if lang := b.match(req.URL.Query().Get(b.QueryParam)); lang != "" {
+		return lang
+	}
+	if cookie, err := req.Cookie(b.CookieName); err == nil {
+		if lang := b.match(cookie.Value); lang != "" {
+			return lang
+		}
+	}
+	for _, lang := range parseAcceptLanguage(req.Header.Get("Accept-Language")) {
+		if lang := b.match(lang); lang != "" {
+			return lang
+		}
+	}
+	return strings.ToLower(b.DefaultLang)
+}
+
+// 按 q 值从高到低返回 Accept-Language 里的语言
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if lang == "" || lang == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		langs = append(langs, weighted{lang, q})
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	result := make([]string, len(langs))
+	for i, l := range langs {
+		result[i] = l.lang
+	}
+	return result
+}
+
+const (
+	localeKey = "pee.locale"
+	bundleKey = "pee.bundle"
+)
+
+// I18n 检测每个请求的语言，之后可以用 c.T 和模板里的 T 翻译
+func I18n(bundle *Bundle) HandlerFunc {
+	return func(c *Context) {
+		c.Set(bundleKey, bundle)
+		c.Set(localeKey, bundle.Detect(c.Req))
+		c.Next()
+	}
+}
+
+// Locale 返回 I18n 中间件检测到的语言
+func (c *Context) Locale() string {
+	lang, _ := c.Keys[localeKey].(string)
+	return lang
+}
+
+// T 用当前请求的语言翻译，没有使用 I18n 中间件时返回 key
+func (c *Context) T(key string, args ...interface{}) string {
+	bundle, ok := c.Keys[bundleKey].(*Bundle)
+	if !ok {
+		return key
+	}
+	return bundle.T(c.Locale(), key, args...)
+}
+
+type localeTemplateKey struct {
+	bundle *Bundle
+	lang   string
+}
+
+// 模板里的 T 绑定到 lang，每个语言只 Clone 一次，之后的请求直接用
+func (e *Engine) localeTemplate(bundle *Bundle, lang string) (*template.Template, error) {
+	key := localeTemplateKey{bundle, lang}
+	if t, ok := e.localeTemplates.Load(key); ok {
+		return t.(*template.Template), nil
+	}
+	t, err := e.templateBase.Clone()
+	if err != nil {
+		return nil, err
+	}
+	t.Funcs(template.FuncMap{"T": func(key string, args ...interface{}) string {
+		return bundle.T(lang, key, args...)
+	}})
+	actual, _ := e.localeTemplates.LoadOrStore(key, t)
+	return actual.(*template.Template), nil
+}
+
+// parseTOML 解析只包含字符串的简单 TOML：key = "value"、[table] 和 # 注释，
+// [table] 下面的 key 放进同名的子表，足够描述复数形式
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	current := result
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: invalid table", lineNo)
+			}
+			name, err := tomlKey(line[1 : len(line)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			table := make(map[string]interface{})
+			result[name] = table
+			current = table
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expect key = value", lineNo)
+		}
+		key, err := tomlKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		value, err := tomlString(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		current[key] = value
+	}
+	return result, scanner.Err()
+}
+
+// key 可以是裸的，也可以带引号
+func tomlKey(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", fmt.Errorf("empty key")
+	}
+	if s[0] == '"' || s[0] == '\'' {
+		return tomlString(s)
+	}
+	return s, nil
+}
+
+// 支持 "基本字符串" 和 '字面字符串'，值后面可以跟 # 注释
+func tomlString(s string) (string, error) {
+	if len(s) >= 2 && s[0] == '\'' {
+		if end := strings.IndexByte(s[1:], '\''); end >= 0 && tomlTrailing(s[end+2:]) {
+			return s[1 : end+1], nil
+		}
+	}
+	if len(s) >= 2 && s[0] == '"' {
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+				continue
+			}
+			if s[i] == '"' && tomlTrailing(s[i+1:]) {
+				return strconv.Unquote(s[:i+1])
+			}
+		}
+	}
+	return "", fmt.Errorf("only string values are supported: %s", s)
+}
+
+// 值后面只能是空白或注释
+func tomlTrailing(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || s[0] == '#'
+}
@@ -0,0 +1,94 @@
+package pee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestBundle(t *testing.T) *Bundle {
+	dir := t.TempDir()
+	files := map[string]string{
+		"en.json": `{"hello": "Hello, %s", "apples": {"one": "%d apple", "other": "%d apples"}, "items": {"one": "one item", "other": "%d items"}}`,
+		"zh.toml": "# 中文\nhello = \"你好，%s\"\n\n[apples]\nother = '%d 个苹果' # 中文没有复数\n",
+		"ru.json": `{"apples": {"one": "%d яблоко", "few": "%d яблока", "many": "%d яблок"}}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bundle := NewBundle("en")
+	if err := bundle.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	return bundle
+}
+
+func TestBundle(t *testing.T) {
+	b := newTestBundle(t)
+	cases := []struct {
+		lang, key string
+		args      []interface{}
+		want      string
+	}{
+		{"en", "hello", []interface{}{"lzj"}, "Hello, lzj"},
+		{"zh-CN", "hello", []interface{}{"lzj"}, "你好，lzj"},
+		{"en", "apples", []interface{}{1}, "1 apple"},
+		{"en", "apples", []interface{}{2}, "2 apples"},
+		{"en", "items", []interface{}{1}, "one item"},
+		{"en", "items", []interface{}{3}, "3 items"},
+		{"zh", "apples", []interface{}{1}, "1 个苹果"},
+		{"ru", "apples", []interface{}{22}, "22 яблока"},
+		{"ru", "apples", []interface{}{25}, "25 яблок"},
+		{"ru", "hello", []interface{}{"lzj"}, "Hello, lzj"},
+		{"fr", "missing", nil, "missing"},
+	}
+	for _, c := range cases {
+		if got := b.T(c.lang, c.key, c.args...); got != c.want {
+			t.Fatalf("T(%s, %s): expect %q, got %q", c.lang, c.key, c.want, got)
+		}
+	}
+}
+
+func TestI18n(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "hello.tmpl"), []byte(`{{T "hello" .}}`), 0o644)
+	r := New()
+	r.Use(I18n(newTestBundle(t)))
+	r.LoadHTMLGlob(filepath.Join(dir, "*"))
+	r.GET("/", func(c *Context) { c.String(http.StatusOK, "%s", c.T("hello", "lzj")) })
+	r.GET("/page", func(c *Context) { c.HTML(http.StatusOK, "hello.tmpl", "lzj") })
+
+	get := func(path string, header ...string) string {
+		req := httptest.NewRequest("GET", path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		return serve(r, req).Body.String()
+	}
+	if body := get("/", "Accept-Language", "fr;q=0.9, zh-CN;q=0.8, en;q=0.5"); body != "你好，lzj" {
+		t.Fatalf("expect chinese from Accept-Language, got %q", body)
+	}
+	if body := get("/?lang=en", "Cookie", "lang=zh"); body != "Hello, lzj" {
+		t.Fatalf("query param should win, got %q", body)
+	}
+	if body := get("/", "Cookie", "lang=zh"); body != "你好，lzj" {
+		t.Fatalf("expect chinese from cookie, got %q", body)
+	}
+	if body := get("/page", "Accept-Language", "en"); body != "Hello, lzj" {
+		t.Fatalf("unexpected template output %q", body)
+	}
+	if body := get("/page?lang=zh"); body != "你好，lzj" {
+		t.Fatalf("unexpected template output %q", body)
+	}
+	// 每个语言只 Clone 一次模板
+	get("/page?lang=zh")
+	clones := 0
+	r.localeTemplates.Range(func(_, _ interface{}) bool { clones++; return true })
+	if clones != 2 {
+		t.Fatalf("expect one template per locale, got %d", clones)
+	}
+}
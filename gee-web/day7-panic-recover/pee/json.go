@@ -0,0 +1,137 @@
+package pee
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// 大于这个容量的缓冲区用完直接丢掉，免得一次大响应一直占着内存
+const maxPooledBuffer = 64 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// 引擎配置的 JSONCodec，没有引擎时用 encoding/json
+func (c *Context) jsonCodec() JSONCodec {
+	if c.engine == nil || c.engine.json == nil {
+		return StdJSON
+	}
+	return c.engine.json
+}
+
+// DecodeJSON 把请求体解码到 obj
+func (c *Context) DecodeJSON(obj interface{}) error {
+	return c.jsonCodec().NewDecoder(c.Req.Body).Decode(obj)
+}
+
+// JSONStreamDecoder 能逐个读取 token 的解码器，DecodeJSONStream 用它遍历数组。
+// JSONCodec 的解码器没有实现它时，改用 encoding/json
+type JSONStreamDecoder interface {
+	JSONDecoder
+	Token() (json.Token, error)
+	More() bool
+}
+
+// DecodeJSONStream 逐个解码请求体里的元素，不用把整个请求读进内存。
+// 请求体可以是 JSON 数组，也可以是 NDJSON 那样一个接一个的值，每个元素调用一次 fn，
+// fn 必须用 decode 把元素解码到自己的变量里，fn 返回错误时停止
+func (c *Context) DecodeJSONStream(fn func(decode func(v interface{}) error) error) error {
+	r := bufio.NewReader(c.Req.Body)
+	first, err := peekNonSpace(r)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	stream, ok := c.jsonCodec().NewDecoder(r).(JSONStreamDecoder)
+	if !ok {
+		stream = json.NewDecoder(r)
+	}
+	if first == '[' {
+		if _, err := stream.Token(); err != nil {
+			return err
+		}
+	}
+	for i := 0; stream.More(); i++ {
+		if err := fn(stream.Decode); err != nil {
+			return fmt.Errorf("pee: element %d: %w", i, err)
+		}
+	}
+	if first != '[' {
+		return nil
+	}
+	_, err = stream.Token()
+	return err
+}
+
+// 跳过空白，返回下一个字节但不读掉它
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			r.ReadByte()
+		default:
+			return b[0], nil
+		}
+	}
+}
+
+// NDJSONWriter 以 application/x-ndjson 流式返回，每个值一行
+type NDJSONWriter struct {
+	c   *Context
+	buf *bytes.Buffer
+	enc JSONEncoder
+}
+
+// NDJSON 开始流式返回，之后用 Encode 一行一行写出去
+func (c *Context) NDJSON(code int) *NDJSONWriter {
+	c.SetHeader("Content-Type", "application/x-ndjson")
+	c.SetHeader("X-Content-Type-Options", "nosniff")
+	c.Status(code)
+	buf := new(bytes.Buffer)
+	return &NDJSONWriter{c: c, buf: buf, enc: c.jsonCodec().NewEncoder(buf)}
+}
+
+// Encode 写一行并立即 Flush，客户端断开后返回错误
+func (w *NDJSONWriter) Encode(v interface{}) error {
+	if err := w.c.Req.Context().Err(); err != nil {
+		return err
+	}
+	w.buf.Reset()
+	if err := w.enc.Encode(v); err != nil {
+		return err
+	}
+	if b := w.buf.Bytes(); len(b) == 0 || b[len(b)-1] != '\n' {
+		w.buf.WriteByte('\n')
+	}
+	if _, err := w.c.Writer.Write(w.buf.Bytes()); err != nil {
+		return err
+	}
+	if f, ok := w.c.Writer.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package pee
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONEncodeError(t *testing.T) {
+	var logs bytes.Buffer
+	r := New(WithMode(TestMode), WithLogger(log.New(&logs, "", 0)))
+	r.GET("/", func(c *Context) { c.JSON(http.StatusOK, H{"ch": make(chan int)}) })
+	w := serve(r, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Type") != "text/plain" {
+		t.Fatalf("expect a clean 500, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if strings.Contains(w.Body.String(), "{") {
+		t.Fatalf("partial json should not be written, got %q", w.Body.String())
+	}
+	// 编码错误只写日志
+	if strings.Contains(w.Body.String(), "chan") || !strings.Contains(logs.String(), "chan int") {
+		t.Fatalf("expect the error in logs only, got body %q, logs %q", w.Body.String(), logs.String())
+	}
+}
+
+func TestDecodeJSONStream(t *testing.T) {
+	type item struct {
+		ID int `json:"id"`
+	}
+	r := New(WithMode(TestMode))
+	r.POST("/", func(c *Context) {
+		sum := 0
+		err := c.DecodeJSONStream(func(decode func(v interface{}) error) error {
+			var it item
+			if err := decode(&it); err != nil {
+				return err
+			}
+			sum += it.ID
+			return nil
+		})
+		if err != nil {
+			c.String(http.StatusBadRequest, "%s", err)
+			return
+		}
+		c.String(http.StatusOK, "%d", sum)
+	})
+	cases := []struct {
+		body string
+		code int
+		want string
+	}{
+		{` [{"id": 1}, {"id": 2}, {"id": 3}]`, http.StatusOK, "6"},
+		{"{\"id\": 1}\n{\"id\": 2}\n", http.StatusOK, "3"},
+		{"", http.StatusOK, "0"},
+		{`[]`, http.StatusOK, "0"},
+		{`[{"id": 1}, {"id": "x"}]`, http.StatusBadRequest, "pee: element 1"},
+	}
+	for _, c := range cases {
+		w := serve(r, httptest.NewRequest("POST", "/", strings.NewReader(c.body)))
+		if w.Code != c.code || !strings.HasPrefix(w.Body.String(), c.want) {
+			t.Fatalf("%q: expect %d %q, got %d %q", c.body, c.code, c.want, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	r := New(WithMode(TestMode))
+	r.GET("/", func(c *Context) {
+		w := c.NDJSON(http.StatusOK)
+		for i := 0; i < 3; i++ {
+			if err := w.Encode(H{"n": i}); err != nil {
+				return
+			}
+		}
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	var lines []string
+	for scanner := bufio.NewScanner(resp.Body); scanner.Scan(); {
+		lines = append(lines, scanner.Text())
+	}
+	if strings.Join(lines, ",") != `{"n":0},{"n":1},{"n":2}` {
+		t.Fatalf("unexpected lines %v", lines)
+	}
+}
@@ -1,7 +1,6 @@
 package pee
 
 import (
-	"log"
 	"time"
 )
 
@@ -12,6 +11,6 @@ func Logger() HandlerFunc {
 		// 处理请求
 		c.Next()
 		// 计算解决时间
-		log.Printf("time: [%d] %s in %v", c.StatusCode, c.Req.RequestURI, time.Since(t))
+		c.engine.logger.Printf("time: [%d] %s in %v", c.StatusCode, c.Req.RequestURI, time.Since(t))
 	}
 }
@@ -0,0 +1,280 @@
+package pee
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 请求耗时的分桶，单位秒，和 Prometheus 客户端的默认值一样
+var defaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// 响应大小的分桶，单位字节
+var defaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+
+// metricLabels 指标的标签，route 用匹配到的路由而不是原始路径，避免标签无限增长
+type metricLabels struct {
+	method string
+	route  string
+	status string
+}
+
+// histogram 累计分桶计数
+type histogram struct {
+	counts []uint64 // 和buckets一一对应，最后一个是 +Inf
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets)+1)
+	}
+	for i, b := range buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.counts[len(buckets)]++
+	h.sum += v
+	h.count++
+}
+
+// Metrics 收集请求数、耗时、处理中的请求数和响应大小，按 Prometheus 文本格式输出
+type Metrics struct {
+	mu        sync.Mutex
+	requests  map[metricLabels]uint64
+	durations map[metricLabels]*histogram
+	sizes     map[metricLabels]*histogram
+	inFlight  map[metricLabels]int64 // 只用 method 和 route
+	gauges    []*gaugeFunc           // GaugeFunc 注册的自定义指标
+}
+
+// gaugeFunc 输出时才取值的 gauge
+type gaugeFunc struct {
+	name   string
+	help   string
+	labels string // 已经格式化好的标签，例如 {name="db"}
+	fn     func() float64
+}
+
+// NewMetrics 创建指标收集器，用法：
+//
+//	m := pee.NewMetrics()
+//	r.Use(m.Middleware())
+//	r.GET("/metrics", m.Handler())
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:  make(map[metricLabels]uint64),
+		durations: make(map[metricLabels]*histogram),
+		sizes:     make(map[metricLabels]*histogram),
+		inFlight:  make(map[metricLabels]int64),
+	}
+}
+
+// sizeWriter 记录响应的状态码和大小
+type sizeWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *sizeWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sizeWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
+}
+
+// Flush 转发给下层的 http.Flusher
+func (w *sizeWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 转发给下层的 http.Hijacker，代理 WebSocket 时需要
+func (w *sizeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("pee: response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+// GaugeFunc 注册一个自定义的 gauge，每次输出指标时调用 fn 取值。
+// labels 是 key, value 交替的标签，同名的 gauge 可以用不同的标签注册多次
+func (m *Metrics) GaugeFunc(name string, help string, fn func() float64, labels ...string) {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+escapeLabel(labels[i+1])+`"`)
+	}
+	formatted := ""
+	if len(pairs) > 0 {
+		formatted = "{" + strings.Join(pairs, ",") + "}"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges = append(m.gauges, &gaugeFunc{name: name, help: help, labels: formatted, fn: fn})
+}
+
+// Middleware 记录每个请求的指标
+func (m *Metrics) Middleware() HandlerFunc {
+	return func(c *Context) {
+		route := c.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		gauge := metricLabels{method: c.Method, route: route}
+		m.mu.Lock()
+		m.inFlight[gauge]++
+		m.mu.Unlock()
+
+		t := time.Now()
+		w := &sizeWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		defer func() {
+			c.Writer = w.ResponseWriter
+			status := w.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			labels := metricLabels{method: c.Method, route: route, status: strconv.Itoa(status)}
+
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.inFlight[gauge]--
+			m.requests[labels]++
+			if m.durations[labels] == nil {
+				m.durations[labels] = &histogram{}
+				m.sizes[labels] = &histogram{}
+			}
+			m.durations[labels].observe(defaultDurationBuckets, time.Since(t).Seconds())
+			m.sizes[labels].observe(defaultSizeBuckets, float64(w.size))
+		}()
+		c.Next()
+	}
+}
+
+// Handler 输出指标的handler
+func (m *Metrics) Handler() HandlerFunc {
+	return func(c *Context) {
+		m.ServeHTTP(c.Writer, c.Req)
+	}
+}
+
+// ServeHTTP 让 Metrics 也可以直接作为 http.Handler 使用
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = m.WriteTo(w)
+}
+
+// WriteTo 按 Prometheus 文本格式写出所有指标
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	var b strings.Builder
+
+	writeHeader(&b, "pee_http_requests_total", "Total number of HTTP requests.", "counter")
+	for _, l := range sortedLabels(m.requests) {
+		fmt.Fprintf(&b, "pee_http_requests_total%s %d\n", l.format(""), m.requests[l])
+	}
+
+	writeHeader(&b, "pee_http_request_duration_seconds", "HTTP request latency in seconds.", "histogram")
+	for _, l := range sortedLabels(m.durations) {
+		writeHistogram(&b, "pee_http_request_duration_seconds", l, defaultDurationBuckets, m.durations[l])
+	}
+
+	writeHeader(&b, "pee_http_response_size_bytes", "HTTP response size in bytes.", "histogram")
+	for _, l := range sortedLabels(m.sizes) {
+		writeHistogram(&b, "pee_http_response_size_bytes", l, defaultSizeBuckets, m.sizes[l])
+	}
+
+	writeHeader(&b, "pee_http_requests_in_flight", "Number of HTTP requests being served.", "gauge")
+	for _, l := range sortedLabels(m.inFlight) {
+		fmt.Fprintf(&b, "pee_http_requests_in_flight%s %d\n", l.format(""), m.inFlight[l])
+	}
+	gauges := append([]*gaugeFunc(nil), m.gauges...)
+	m.mu.Unlock()
+
+	// fn 可能要拿别的锁，不在 m.mu 里调用；同名的放在一起输出
+	sort.SliceStable(gauges, func(i, j int) bool { return gauges[i].name < gauges[j].name })
+	for i, g := range gauges {
+		if i == 0 || gauges[i-1].name != g.name {
+			writeHeader(&b, g.name, g.help, "gauge")
+		}
+		fmt.Fprintf(&b, "%s%s %s\n", g.name, g.labels, formatFloat(g.fn()))
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func writeHeader(b *strings.Builder, name string, help string, typ string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeHistogram(b *strings.Builder, name string, l metricLabels, buckets []float64, h *histogram) {
+	for i, bucket := range buckets {
+		fmt.Fprintf(b, "%s_bucket%s %d\n", name, l.format(formatFloat(bucket)), h.counts[i])
+	}
+	fmt.Fprintf(b, "%s_bucket%s %d\n", name, l.format("+Inf"), h.counts[len(buckets)])
+	fmt.Fprintf(b, "%s_sum%s %s\n", name, l.format(""), formatFloat(h.sum))
+	fmt.Fprintf(b, "%s_count%s %d\n", name, l.format(""), h.count)
+}
+
+// format 输出 {method="GET",route="/",status="200"}，le 不为空时加上分桶标签
+func (l metricLabels) format(le string) string {
+	pairs := []string{`method="` + escapeLabel(l.method) + `"`, `route="` + escapeLabel(l.route) + `"`}
+	if l.status != "" {
+		pairs = append(pairs, `status="`+l.status+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// 转义标签值里的 \ " 和换行
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// 按标签排序，保证每次输出的顺序一样
+func sortedLabels[V any](m map[metricLabels]V) []metricLabels {
+	labels := make([]metricLabels, 0, len(m))
+	for l := range m {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].route != labels[j].route {
+			return labels[i].route < labels[j].route
+		}
+		if labels[i].method != labels[j].method {
+			return labels[i].method < labels[j].method
+		}
+		return labels[i].status < labels[j].status
+	})
+	return labels
+}
@@ -0,0 +1,35 @@
+package pee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	r := New()
+	r.Use(m.Middleware())
+	r.GET("/users/:id", func(c *Context) { c.String(http.StatusOK, "user %s", c.Param("id")) })
+	r.GET("/metrics", m.Handler())
+
+	serve(r, httptest.NewRequest("GET", "/users/1", nil))
+	serve(r, httptest.NewRequest("GET", "/users/2", nil))
+	serve(r, httptest.NewRequest("GET", "/missing", nil))
+	body := serve(r, httptest.NewRequest("GET", "/metrics", nil)).Body.String()
+
+	for _, line := range []string{
+		"# TYPE pee_http_requests_total counter",
+		`pee_http_requests_total{method="GET",route="/users/:id",status="200"} 2`,
+		`pee_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`pee_http_request_duration_seconds_count{method="GET",route="/users/:id",status="200"} 2`,
+		`pee_http_response_size_bytes_bucket{method="GET",route="/users/:id",status="200",le="100"} 2`,
+		`pee_http_response_size_bytes_sum{method="GET",route="/users/:id",status="200"} 12`,
+		`pee_http_requests_in_flight{method="GET",route="/metrics"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("expect metrics to contain %q, got\n%s", line, body)
+		}
+	}
+}
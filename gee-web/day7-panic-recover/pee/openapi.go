@@ -0,0 +1,319 @@
+package pee
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RouteDoc 注册路由时附加的接口文档
+type RouteDoc struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Request     interface{}         // 请求体的类型，例如 User{}
+	Responses   map[int]interface{} // 状态码对应的响应体类型，值为nil表示没有响应体
+	Params      []ParamDoc          // query、header 参数，路径参数会从 pattern 里自动生成
+}
+
+// ParamDoc 一个 query 或 header 参数
+type ParamDoc struct {
+	Name        string
+	In          string // query 或 header
+	Description string
+	Required    bool
+	Type        string // string、integer、number、boolean，默认 string
+}
+
+// OpenAPIInfo 文档的基本信息
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Doc 给路由附加接口文档，例如 r.GET("/users/:id", h).Doc(pee.RouteDoc{Summary: "查询用户", Responses: map[int]interface{}{200: User{}}})
+func (r *Route) Doc(doc RouteDoc) *Route {
+	r.engine.updateMeta(r, func(_ *router, m *routeMeta) {
+		m.doc = &doc
+	})
+	return r
+}
+
+// openAPIPath 把 /users/:id、/files/*path、/posts/{id:int} 转成 OpenAPI 的 /users/{id} 形式
+func openAPIPath(pattern string) (string, []map[string]interface{}) {
+	var b strings.Builder
+	var params []map[string]interface{}
+	for _, part := range parsePatten(pattern) {
+		b.WriteByte('/')
+		name := paramName(part)
+		if name == "" {
+			b.WriteString(part)
+			continue
+		}
+		b.WriteString("{" + name + "}")
+		schema := map[string]interface{}{"type": "string"}
+		if part[0] == '{' {
+			_, constraint, _ := strings.Cut(part[1:len(part)-1], ":")
+			switch constraint {
+			case "int", "uint":
+				schema["type"] = "integer"
+			case "uuid":
+				schema["format"] = "uuid"
+			default:
+				if _, ok := paramTypes[constraint]; !ok {
+					schema["pattern"] = "^" + constraint + "$"
+				}
+			}
+		}
+		params = append(params, map[string]interface{}{"name": name, "in": "path", "required": true, "schema": schema})
+	}
+	if b.Len() == 0 {
+		return "/", params
+	}
+	return b.String(), params
+}
+
+// schemaBuilder 通过反射生成 JSON Schema，具名的结构体放到 components.schemas 里
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (s *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := s.components[t.Name()]; !ok {
+			// 先占位，防止递归的结构体死循环
+			s.components[t.Name()] = nil
+			s.components[t.Name()] = s.object(t)
+		}
+		return ref
+	}
+	return map[string]interface{}{}
+}
+
+// object 按 json tag 生成结构体的属性，没有 omitempty 的字段是必填的
+func (s *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			// 嵌入的结构体字段展开到外层
+			embedded := s.object(field.Type)
+			for k, v := range embedded["properties"].(map[string]interface{}) {
+				properties[k] = v
+			}
+			if r, ok := embedded["required"].([]string); ok {
+				required = append(required, r...)
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.schema(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	obj := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		obj["required"] = required
+	}
+	return obj
+}
+
+// OpenAPI 根据注册的路由和附加的文档生成 OpenAPI 3 的 JSON
+func (e *Engine) OpenAPI(info OpenAPIInfo) ([]byte, error) {
+	builder := &schemaBuilder{components: make(map[string]interface{})}
+	paths := make(map[string]map[string]interface{})
+	rt := e.router.Load()
+	for _, route := range rt.routes {
+		meta := rt.meta[route]
+		method := strings.ToLower(route.Method)
+		if meta.hidden || method == "connect" {
+			continue
+		}
+		p, params := openAPIPath(route.Pattern)
+		op := map[string]interface{}{}
+		responses := map[string]interface{}{}
+		if doc := meta.doc; doc != nil {
+			if doc.Summary != "" {
+				op["summary"] = doc.Summary
+			}
+			if doc.Description != "" {
+				op["description"] = doc.Description
+			}
+			if len(doc.Tags) > 0 {
+				op["tags"] = doc.Tags
+			}
+			for _, param := range doc.Params {
+				typ := param.Type
+				if typ == "" {
+					typ = "string"
+				}
+				p := map[string]interface{}{"name": param.Name, "in": param.In, "schema": map[string]interface{}{"type": typ}}
+				if param.Required {
+					p["required"] = true
+				}
+				if param.Description != "" {
+					p["description"] = param.Description
+				}
+				params = append(params, p)
+			}
+			if doc.Request != nil {
+				op["requestBody"] = map[string]interface{}{
+					"required": true,
+					"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": builder.schema(reflect.TypeOf(doc.Request))}},
+				}
+			}
+			for code, body := range doc.Responses {
+				resp := map[string]interface{}{"description": http.StatusText(code)}
+				if body != nil {
+					resp["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": builder.schema(reflect.TypeOf(body))}}
+				}
+				responses[strconv.Itoa(code)] = resp
+			}
+		}
+		if len(responses) == 0 {
+			responses["default"] = map[string]interface{}{"description": "default response"}
+		}
+		op["responses"] = responses
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if meta.name != "" {
+			op["operationId"] = meta.name
+		}
+		if paths[p] == nil {
+			paths[p] = make(map[string]interface{})
+		}
+		paths[p][method] = op
+	}
+
+	spec := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    info,
+		"paths":   paths,
+	}
+	if len(builder.components) > 0 {
+		spec["components"] = map[string]interface{}{"schemas": builder.components}
+	}
+	return json.MarshalIndent(spec, "", "  ")
+}
+
+// 默认的 Swagger UI 资源，固定版本，不跟着 CDN 上的新版本变
+const (
+	defaultSwaggerUICSS = "https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui.css"
+	defaultSwaggerUIJS  = "https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui-bundle.js"
+)
+
+// OpenAPIConfig ServeOpenAPIWithConfig 的配置
+type OpenAPIConfig struct {
+	SpecPath string // OpenAPI JSON 的路径
+	DocsPath string // 文档页面的路径，为空时不注册页面
+	Info     OpenAPIInfo
+
+	// 文档页面加载的 Swagger UI 资源，默认是 unpkg 上固定版本的 swagger-ui-dist，
+	// 可以换成自己托管的地址。设置了 Integrity 时页面带上 integrity 和 crossorigin 做 SRI 校验
+	SwaggerUICSS          string
+	SwaggerUIJS           string
+	SwaggerUICSSIntegrity string
+	SwaggerUIJSIntegrity  string
+}
+
+// 文档页面，使用 Swagger UI 渲染
+var docsTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>{{.Info.Title}}</title>
+  <link rel="stylesheet" href="{{.SwaggerUICSS}}"{{with .SwaggerUICSSIntegrity}} integrity="{{.}}" crossorigin="anonymous"{{end}}>
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="{{.SwaggerUIJS}}"{{with .SwaggerUIJSIntegrity}} integrity="{{.}}" crossorigin="anonymous"{{end}}></script>
+  <script>window.ui = SwaggerUIBundle({url: "{{.SpecPath}}", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`))
+
+// ServeOpenAPI 在 specPath 提供 OpenAPI JSON，在 docsPath 提供文档页面，docsPath 为空时不注册页面。
+// 每次请求都重新生成，之后注册的路由也会出现在文档里
+func (g *RouterGroup) ServeOpenAPI(specPath string, docsPath string, info OpenAPIInfo) {
+	g.ServeOpenAPIWithConfig(OpenAPIConfig{SpecPath: specPath, DocsPath: docsPath, Info: info})
+}
+
+// ServeOpenAPIWithConfig 和 ServeOpenAPI 一样，还可以指定文档页面使用的 Swagger UI 资源
+func (g *RouterGroup) ServeOpenAPIWithConfig(conf OpenAPIConfig) {
+	if conf.SwaggerUICSS == "" {
+		conf.SwaggerUICSS = defaultSwaggerUICSS
+	}
+	if conf.SwaggerUIJS == "" {
+		conf.SwaggerUIJS = defaultSwaggerUIJS
+	}
+	e := g.engine
+	info := conf.Info
+	routes := []*Route{g.newRoute("GET", conf.SpecPath, func(c *Context) {
+		spec, err := e.OpenAPI(info)
+		if err != nil {
+			c.Fail(http.StatusInternalServerError, fmt.Sprintf("pee: generate openapi: %v", err))
+			return
+		}
+		c.SetHeader("Content-Type", "application/json")
+		c.Data(http.StatusOK, spec)
+	})}
+	if conf.DocsPath != "" {
+		// 页面里用的是完整的路径
+		conf.SpecPath = g.prefix + conf.SpecPath
+		routes = append(routes, g.newRoute("GET", conf.DocsPath, func(c *Context) {
+			c.SetHeader("Content-Type", "text/html; charset=utf-8")
+			c.Status(http.StatusOK)
+			_ = docsTemplate.Execute(c.Writer, conf)
+		}))
+	}
+	e.register(true, routes...)
+}
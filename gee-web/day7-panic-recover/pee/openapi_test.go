@@ -0,0 +1,79 @@
+package pee
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type docUser struct {
+	ID      int64      `json:"id"`
+	Name    string     `json:"name"`
+	Tags    []string   `json:"tags,omitempty"`
+	Friends []*docUser `json:"friends,omitempty"`
+	secret  string
+}
+
+func TestOpenAPI(t *testing.T) {
+	r := New()
+	r.GET("/users/{id:int}", nil).Name("user.show").Doc(RouteDoc{
+		Summary:   "show user",
+		Params:    []ParamDoc{{Name: "verbose", In: "query", Type: "boolean"}},
+		Responses: map[int]interface{}{200: docUser{}, 404: nil},
+	})
+	r.POST("/users", nil).Doc(RouteDoc{Request: &docUser{}, Responses: map[int]interface{}{201: docUser{}}})
+	r.Mount("/debug", http.NotFoundHandler())
+	r.ServeOpenAPI("/openapi.json", "/docs", OpenAPIInfo{Title: "pee", Version: "1.0"})
+
+	w := serve(r, httptest.NewRequest("GET", "/openapi.json", nil))
+	var spec struct {
+		Paths      map[string]map[string]map[string]interface{}
+		Components struct {
+			Schemas map[string]map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Paths) != 2 {
+		t.Fatalf("expect only documented paths, got %v", reflect.ValueOf(spec.Paths).MapKeys())
+	}
+	show := spec.Paths["/users/{id}"]["get"]
+	if show["summary"] != "show user" || show["operationId"] != "user.show" || len(show["parameters"].([]interface{})) != 2 {
+		t.Fatalf("unexpected operation %v", show)
+	}
+	user := spec.Components.Schemas["docUser"]
+	if !reflect.DeepEqual(user["required"], []interface{}{"id", "name"}) || len(user["properties"].(map[string]interface{})) != 4 {
+		t.Fatalf("unexpected schema %v", user)
+	}
+	if _, ok := spec.Paths["/users"]["post"]["requestBody"]; !ok {
+		t.Fatal("expect a request body")
+	}
+	if body := serve(r, httptest.NewRequest("GET", "/docs", nil)).Body.String(); !strings.Contains(body, `openapi.json`) {
+		t.Fatalf("docs page should point at the spec, got %s", body)
+	}
+}
+
+func TestServeOpenAPIWithConfig(t *testing.T) {
+	r := New()
+	r.ServeOpenAPI("/openapi.json", "/docs", OpenAPIInfo{Title: "pee"})
+	r.Group("/internal").ServeOpenAPIWithConfig(OpenAPIConfig{
+		SpecPath:             "/openapi.json",
+		DocsPath:             "/docs",
+		SwaggerUIJS:          "/static/swagger-ui-bundle.js",
+		SwaggerUIJSIntegrity: "sha384-abc",
+	})
+
+	body := serve(r, httptest.NewRequest("GET", "/docs", nil)).Body.String()
+	if !strings.Contains(body, defaultSwaggerUIJS) || strings.Contains(body, "integrity") {
+		t.Fatalf("expect pinned default assets, got %s", body)
+	}
+	body = serve(r, httptest.NewRequest("GET", "/internal/docs", nil)).Body.String()
+	if !strings.Contains(body, `src="/static/swagger-ui-bundle.js" integrity="sha384-abc" crossorigin="anonymous"`) ||
+		!strings.Contains(body, defaultSwaggerUICSS) || !strings.Contains(body, `\/internal\/openapi.json`) {
+		t.Fatalf("expect custom assets with integrity, got %s", body)
+	}
+}
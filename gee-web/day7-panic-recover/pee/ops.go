@@ -0,0 +1,179 @@
+package pee
+
+import (
+	"context"
+	"crypto/subtle"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checker 健康检查，返回错误表示不健康
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc 把函数当成 Checker 使用
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Pinger 可以 ping 的数据库连接，*sql.DB 和 porm 的 Engine 都实现了它
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// PingChecker 用 ping 检查数据库是否可用
+func PingChecker(db Pinger) Checker {
+	return CheckerFunc(db.PingContext)
+}
+
+// BuildInfo 构建信息，空的字段从 runtime/debug.ReadBuildInfo 里补上
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// OpsConfig 运维接口的配置
+type OpsConfig struct {
+	Liveness     map[string]Checker // /healthz 的检查，进程还活着就应该通过
+	Readiness    map[string]Checker // /readyz 的检查，例如数据库，不通过时不应该接流量
+	CheckTimeout time.Duration      // 每次检查的超时时间，默认 5s
+	BuildInfo    BuildInfo          // /buildinfo 返回的信息
+	// /debug 下的 pprof 和 expvar 的中间件，用来做鉴权，例如 BasicAuth。
+	// 为空时不注册 /debug，免得把 pprof 暴露出去
+	DebugMiddlewares []HandlerFunc
+}
+
+// RegisterOps 在分组下注册 /healthz、/readyz、/buildinfo，
+// 配置了 DebugMiddlewares 时还会注册 /debug/pprof 和 /debug/vars，这些路由都不出现在 OpenAPI 文档里
+func (g *RouterGroup) RegisterOps(conf OpsConfig) {
+	if conf.CheckTimeout <= 0 {
+		conf.CheckTimeout = 5 * time.Second
+	}
+	info := conf.BuildInfo.fill()
+	routes := []*Route{
+		g.newRoute("GET", "/healthz", checkHandler(conf.Liveness, conf.CheckTimeout)),
+		g.newRoute("GET", "/readyz", checkHandler(conf.Readiness, conf.CheckTimeout)),
+		g.newRoute("GET", "/buildinfo", func(c *Context) { c.JSON(http.StatusOK, info) }),
+	}
+	if len(conf.DebugMiddlewares) > 0 {
+		debugGroup := g.Group("/debug")
+		debugGroup.Use(conf.DebugMiddlewares...)
+		for _, method := range []string{http.MethodGet, http.MethodPost} {
+			routes = append(routes,
+				debugGroup.newRoute(method, "/pprof", pprofHandler),
+				debugGroup.newRoute(method, "/pprof/*name", pprofHandler),
+			)
+		}
+		routes = append(routes, debugGroup.newRoute("GET", "/vars", WrapH(expvar.Handler())))
+	}
+	// 运维接口不出现在 OpenAPI 文档里
+	g.engine.register(true, routes...)
+}
+
+// 没有设置的字段用二进制里的构建信息补上
+func (info BuildInfo) fill() BuildInfo {
+	info.GoVersion = runtime.Version()
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch {
+		case s.Key == "vcs.revision" && info.Commit == "":
+			info.Commit = s.Value
+		case s.Key == "vcs.time" && info.BuildTime == "":
+			info.BuildTime = s.Value
+		}
+	}
+	return info
+}
+
+// 并发执行所有检查，全部通过返回 200，否则返回 503 和失败的原因
+func checkHandler(checkers map[string]Checker, timeout time.Duration) HandlerFunc {
+	names := make([]string, 0, len(checkers))
+	for name := range checkers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return func(c *Context) {
+		ctx, cancel := context.WithTimeout(c.Req.Context(), timeout)
+		defer cancel()
+		results := make([]string, len(names))
+		var wg sync.WaitGroup
+		for i, name := range names {
+			wg.Add(1)
+			go func(i int, checker Checker) {
+				defer wg.Done()
+				results[i] = "ok"
+				if err := checker.Check(ctx); err != nil {
+					results[i] = err.Error()
+				}
+			}(i, checkers[name])
+		}
+		wg.Wait()
+
+		status, code := "ok", http.StatusOK
+		checks := make(map[string]string, len(names))
+		for i, name := range names {
+			checks[name] = results[i]
+			if results[i] != "ok" {
+				status, code = "unavailable", http.StatusServiceUnavailable
+			}
+		}
+		c.SetHeader("Cache-Control", "no-store")
+		c.JSON(code, H{"status": status, "checks": checks})
+	}
+}
+
+// pprof.Index 要求路径以 /debug/pprof/ 开头，挂在别的前缀下时按参数自己分发
+func pprofHandler(c *Context) {
+	if !strings.HasSuffix(c.Req.URL.Path, "/") && c.Param("name") == "" {
+		// 首页里的链接是相对路径，必须以 / 结尾
+		c.Redirect(http.StatusMovedPermanently, c.Req.URL.Path+"/")
+		return
+	}
+	switch name := c.Param("name"); name {
+	case "":
+		pprof.Index(c.Writer, c.Req)
+	case "cmdline":
+		pprof.Cmdline(c.Writer, c.Req)
+	case "profile":
+		pprof.Profile(c.Writer, c.Req)
+	case "symbol":
+		pprof.Symbol(c.Writer, c.Req)
+	case "trace":
+		pprof.Trace(c.Writer, c.Req)
+	default:
+		pprof.Handler(name).ServeHTTP(c.Writer, c.Req)
+	}
+}
+
+// BasicAuth HTTP 基本认证，accounts 的 key 是用户名，value 是密码
+func BasicAuth(accounts map[string]string) HandlerFunc {
+	return func(c *Context) {
+		user, password, ok := c.Req.BasicAuth()
+		if ok {
+			if want, exists := accounts[user]; exists && subtle.ConstantTimeCompare([]byte(password), []byte(want)) == 1 {
+				c.Next()
+				return
+			}
+		}
+		c.SetHeader("WWW-Authenticate", `Basic realm="pee"`)
+		c.Fail(http.StatusUnauthorized, "unauthorized")
+	}
+}
@@ -0,0 +1,78 @@
+package pee
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeDB struct{ err error }
+
+func (db fakeDB) PingContext(ctx context.Context) error { return db.err }
+
+func TestRegisterOps(t *testing.T) {
+	db := &fakeDB{}
+	r := New(WithMode(TestMode))
+	r.Group("/ops").RegisterOps(OpsConfig{
+		Readiness:        map[string]Checker{"db": PingChecker(db)},
+		BuildInfo:        BuildInfo{Version: "v1.2.3"},
+		DebugMiddlewares: []HandlerFunc{BasicAuth(map[string]string{"admin": "secret"})},
+	})
+
+	if w := serve(r, httptest.NewRequest("GET", "/ops/healthz", nil)); w.Code != http.StatusOK {
+		t.Fatalf("expect healthy, got %d", w.Code)
+	}
+	if w := serve(r, httptest.NewRequest("GET", "/ops/readyz", nil)); w.Code != http.StatusOK {
+		t.Fatalf("expect ready, got %d %s", w.Code, w.Body.String())
+	}
+	db.err = errors.New("connection refused")
+	w := serve(r, httptest.NewRequest("GET", "/ops/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"db":"connection refused"`) {
+		t.Fatalf("expect not ready, got %d %s", w.Code, w.Body.String())
+	}
+
+	var info BuildInfo
+	_ = json.Unmarshal(serve(r, httptest.NewRequest("GET", "/ops/buildinfo", nil)).Body.Bytes(), &info)
+	if info.Version != "v1.2.3" || info.GoVersion == "" {
+		t.Fatalf("unexpected build info %+v", info)
+	}
+
+	if w := serve(r, httptest.NewRequest("GET", "/ops/debug/pprof/", nil)); w.Code != http.StatusUnauthorized {
+		t.Fatalf("debug routes should be protected, got %d", w.Code)
+	}
+	cases := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/ops/debug/pprof", http.StatusMovedPermanently, ""},
+		{"/ops/debug/pprof/", http.StatusOK, "goroutine"},
+		{"/ops/debug/pprof/goroutine?debug=1", http.StatusOK, "goroutine profile"},
+		{"/ops/debug/vars", http.StatusOK, "memstats"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.SetBasicAuth("admin", "secret")
+		w := serve(r, req)
+		if w.Code != c.code || !strings.Contains(w.Body.String(), c.body) {
+			t.Fatalf("%s: expect %d, got %d", c.path, c.code, w.Code)
+		}
+	}
+
+	spec, _ := r.OpenAPI(OpenAPIInfo{Title: "ops"})
+	if strings.Contains(string(spec), "/ops/") {
+		t.Fatalf("ops routes should be hidden, got %s", spec)
+	}
+}
+
+func TestRegisterOpsWithoutDebug(t *testing.T) {
+	r := New(WithMode(TestMode))
+	r.RegisterOps(OpsConfig{})
+	if w := serve(r, httptest.NewRequest("GET", "/debug/pprof/", nil)); w.Code != http.StatusNotFound {
+		t.Fatalf("pprof should not be exposed without middlewares, got %d", w.Code)
+	}
+}
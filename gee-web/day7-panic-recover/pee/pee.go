@@ -2,10 +2,12 @@ package pee
 
 import (
 	"html/template"
-	"log"
+	"net"
 	"net/http"
 	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // 将HandlerFunc定义为此func，使用了context
@@ -15,23 +17,41 @@ type (
 	Engine struct {
 		// 路由映射表，key由静态方法和静态路由地址构成，如GET-/、GET-/hello、POST-/hello
 		// 相同的路由不同的请求方法可以映射到不同的处理方法(Handler)，value是用户映射的处理方法
-		router        *router // router.go里面的结构体
-		*RouterGroup          // 这是 go 中的嵌套类型，类似 Java/Python 等语言的继承。这样 Engine 就可以拥有 RouterGroup 的属性了。
-		groups        []*RouterGroup
-		htmlTemplates *template.Template
-		funcMap       template.FuncMap
+		// 路由表只读，修改时拷贝一份改完再原子替换，服务运行时也可以增删路由
+		router         atomic.Pointer[router] // router.go里面的结构体
+		routerMu       sync.Mutex             // 保证同一时间只有一个修改路由表
+		*RouterGroup                          // 这是 go 中的嵌套类型，类似 Java/Python 等语言的继承。这样 Engine 就可以拥有 RouterGroup 的属性了。
+		groups         []*RouterGroup
+		groupsMu       sync.RWMutex // 保护 groups 和分组的中间件
+		htmlTemplates  *template.Template
+		templateBase   *template.Template // 没有执行过的模板，i18n 时使用
+		funcMap        template.FuncMap
+		trustedProxies atomic.Pointer[[]*net.IPNet] // 可信代理，ClientIP 使用，服务运行时也可以修改
+
+		localeTemplates sync.Map                 // 每个语言 Clone 一份模板，key 是 localeTemplateKey，i18n 时使用
+		remoteIPHeaders atomic.Pointer[[]string] // ClientIP 按顺序读取的请求头，见 SetRemoteIPHeaders
+
+		// 下面是 Option 配置的字段，见 config.go
+		mode                  string
+		logger                LogPrinter
+		maxBodySize           int64
+		redirectTrailingSlash bool
+		redirectFixedPath     bool
+		json                  JSONCodec
 	}
 
 	RouterGroup struct {
 		prefix      string        // 前缀
 		middlewares []HandlerFunc // 中间件
 		engine      *Engine       // 分组由他控制
+		host        *hostPattern  // 只处理这个host的请求，为nil时处理所有host
+		matchers    []Matcher     // 请求还要满足的条件，比如请求头、query
 	}
 )
 
 // 默认实例使用 Logger 和 Recovery 中间件。
-func Default() *Engine {
-	engine := New()
+func Default(opts ...Option) *Engine {
+	engine := New(opts...)
 	engine.Use(Logger(), Recovery())
 	return engine
 }
@@ -41,45 +61,143 @@ func (e *Engine) SetFuncMap(funcMap template.FuncMap) {
 	e.funcMap = funcMap
 }
 
-// 模板加载进内存
+// 模板加载进内存，内置的 url 函数可以在模板里反向生成路由，例如 {{url "user.show" "id" 42}}，
+// 内置的 T 函数用当前请求的语言翻译，例如 {{T "hello" .name}}
 func (e *Engine) LoadHTMLGlob(pattern string) {
-	e.htmlTemplates = template.Must(template.New("").Funcs(e.funcMap).ParseGlob(pattern))
+	funcMap := template.FuncMap{
+		"url": e.URL,
+		"T":   func(key string, args ...interface{}) string { return key },
+	}
+	for name, fn := range e.funcMap {
+		funcMap[name] = fn
+	}
+	e.htmlTemplates = template.Must(template.New("").Funcs(funcMap).ParseGlob(pattern))
+	// 执行过的模板不能再 Clone，留一份没执行过的，按请求绑定 T 时从这里 Clone
+	e.templateBase = template.Must(e.htmlTemplates.Clone())
+	e.localeTemplates.Clear()
 }
 
 // 给en的分组和组赋值，Group里面的engine里面的Group和Groups是一个，地址一样。
-func New() *Engine {
-	engine := &Engine{router: newRouter()}
+// opts 用来配置引擎，例如 pee.New(pee.WithMode(pee.ReleaseMode), pee.WithMaxBodySize(1<<20))
+func New(opts ...Option) *Engine {
+	engine := &Engine{}
+	engine.router.Store(newRouter())
 	engine.RouterGroup = &RouterGroup{engine: engine}
 	engine.groups = []*RouterGroup{engine.RouterGroup}
+	engine.configure(opts)
 	return engine
 }
 
 // 所有组共享同一个引擎实例
 func (g *RouterGroup) Group(prefix string) *RouterGroup {
+	return g.group(prefix, nil)
+}
+
+// 新建子分组，setup 在分组加入引擎之前修改分组，避免正在处理的请求看到改了一半的分组
+func (g *RouterGroup) group(prefix string, setup func(*RouterGroup)) *RouterGroup {
 	engine := g.engine
 	newGroup := &RouterGroup{ // 每次进来都新建一个路由组保存分组前缀。
-		prefix: g.prefix + prefix,
-		engine: engine,
+		prefix:   g.prefix + prefix,
+		engine:   engine,
+		host:     g.host,
+		matchers: g.matchers, // 共用父分组的切片，用来判断路由的 matcher 是否相同
 	}
+	if setup != nil {
+		setup(newGroup)
+	}
+	engine.groupsMu.Lock()
 	engine.groups = append(engine.groups, newGroup) // 把当前组加入到分组控制路由的组里
+	engine.groupsMu.Unlock()
 	return newGroup
 }
 
+// 只处理某个host的分组，host里可以用 {tenant}.example.com 这样的参数，参数会放进Params
+func (g *RouterGroup) Host(host string) *RouterGroup {
+	return g.group("", func(newGroup *RouterGroup) {
+		newGroup.host = newHostPattern(host)
+	})
+}
+
+// 只处理满足matcher的请求的分组，例如 r.Match(pee.MatchHeader("Accept", "application/vnd.pee.v2+json"))
+func (g *RouterGroup) Match(matchers ...Matcher) *RouterGroup {
+	return g.group("", func(newGroup *RouterGroup) {
+		// 不在父分组的切片上追加
+		newGroup.matchers = append(newGroup.matchers[:len(newGroup.matchers):len(newGroup.matchers)], matchers...)
+	})
+}
+
+// 请求是否属于这个分组，有host的分组只处理这个host下注册的路由，route 是请求匹配到的路由，可能为nil
+func (g *RouterGroup) match(req *http.Request, route *Route) bool {
+	if !strings.HasPrefix(req.URL.Path, g.prefix) {
+		return false
+	}
+	if g.host != nil && (route == nil || route.Host != g.host.host) {
+		return false
+	}
+	for _, m := range g.matchers {
+		if !m(req) {
+			return false
+		}
+	}
+	return true
+}
+
 // 把路由和请求方法注册到映射表router
-func (g *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) {
-	pattern := g.prefix + comp
-	log.Printf("Route %4s - %s", method, pattern)
-	g.engine.router.addRoute(method, pattern, handler)
+func (g *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) *Route {
+	return g.engine.register(false, g.newRoute(method, comp, handler))[0]
+}
+
+// 创建分组下的路由，还没有加进路由表
+func (g *RouterGroup) newRoute(method string, comp string, handler HandlerFunc) *Route {
+	route := &Route{
+		Method:   method,
+		Pattern:  g.prefix + comp,
+		handler:  handler,
+		matchers: g.matchers,
+		engine:   g.engine,
+	}
+	if g.host != nil {
+		route.Host = g.host.host
+	}
+	return route
+}
+
+// 把一批路由加进路由表，只生成一次新的路由表。hidden 为 true 时路由不出现在 OpenAPI 文档里，
+// 在路由表发布之前设置好，不会和正在读路由表的请求冲突
+func (e *Engine) register(hidden bool, routes ...*Route) []*Route {
+	for _, route := range routes {
+		e.debugPrintf("Route %4s - %s", route.Method, route.Pattern)
+	}
+	e.updateRouter(func(old *router) *router {
+		r := old.clone()
+		for _, route := range routes {
+			r.add(route)
+			if hidden {
+				m := r.meta[route]
+				m.hidden = true
+				r.meta[route] = m
+			}
+		}
+		return r
+	})
+	return routes
+}
+
+// 修改路由表，fn 返回新的路由表，不能修改 old，正在处理的请求还在用它
+func (e *Engine) updateRouter(fn func(old *router) *router) {
+	e.routerMu.Lock()
+	defer e.routerMu.Unlock()
+	e.router.Store(fn(e.router.Load()))
 }
 
 // GET请求
-func (g *RouterGroup) GET(pattern string, handler HandlerFunc) {
-	g.addRoute("GET", pattern, handler)
+func (g *RouterGroup) GET(pattern string, handler HandlerFunc) *Route {
+	return g.addRoute("GET", pattern, handler)
 }
 
 // POST
-func (g *RouterGroup) POST(patter string, handler HandlerFunc) {
-	g.addRoute("POST", patter, handler)
+func (g *RouterGroup) POST(patter string, handler HandlerFunc) *Route {
+	return g.addRoute("POST", patter, handler)
 }
 
 // ListenAndServe的包装，启动httpserver
@@ -90,7 +208,10 @@ func (e *Engine) Run(add string) (err error) {
 
 // 加入中间件
 func (g *RouterGroup) Use(middlewares ...HandlerFunc) {
-	g.middlewares = append(g.middlewares, middlewares...)
+	g.engine.groupsMu.Lock()
+	defer g.engine.groupsMu.Unlock()
+	// 不在原来的切片上追加，已经取走中间件的请求不受影响
+	g.middlewares = append(g.middlewares[:len(g.middlewares):len(g.middlewares)], middlewares...)
 }
 
 // 创建静态handler
@@ -127,14 +248,26 @@ func (g *RouterGroup) Static(relativePath string, root string) {
 // 解析请求的路径，查找路由映射表，如果查到，就执行注册的处理方法。
 // 如果查不到，就返回 404 NOT FOUND。
 func (e *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// 先找到路由，分组的中间件要看路由是不是这个分组的host下的
+	r := e.router.Load()
+	route, params := r.route(req)
 	var middlewares []HandlerFunc
+	e.groupsMu.RLock()
 	for _, group := range e.groups {
-		if strings.HasPrefix(req.URL.Path, group.prefix) { // 判断前缀，看请求适合哪个中间件
+		if group.match(req, route) { // 判断前缀、host和matcher，看请求适合哪个中间件
 			middlewares = append(middlewares, group.middlewares...) // 保存适用的中间件
 		}
 	}
+	e.groupsMu.RUnlock()
+	if e.maxBodySize > 0 {
+		if req.ContentLength > e.maxBodySize {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		req.Body = http.MaxBytesReader(w, req.Body, e.maxBodySize)
+	}
 	c := newContext(w, req)
 	c.handlers = middlewares // 把需要运行的中间件保存在handlers上去执行。
 	c.engine = e             // 为了让模板能用上en指针赋值
-	e.router.handle(c)
+	r.handle(c, route, params)
 }
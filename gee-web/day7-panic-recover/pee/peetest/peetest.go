@@ -0,0 +1,204 @@
+// Package peetest 基于 httptest 的测试工具，不用启动服务就能测试 pee 的 handler 和中间件
+//
+//	peetest.New(t, engine).GET("/x").WithJSON(body).Expect().Status(200).JSON(want)
+package peetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"pee"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Tester 发起测试请求，handler 一般是 *pee.Engine
+type Tester struct {
+	t       testing.TB
+	handler http.Handler
+}
+
+// New 创建一个 Tester，断言失败时通过 t 报错
+func New(t testing.TB, handler http.Handler) *Tester {
+	return &Tester{t: t, handler: handler}
+}
+
+// Request 还没有发出的测试请求
+type Request struct {
+	tester *Tester
+	method string
+	path   string
+	host   string
+	header http.Header
+	query  url.Values
+	body   io.Reader
+}
+
+// Request 创建任意方法的请求
+func (t *Tester) Request(method string, path string) *Request {
+	return &Request{
+		tester: t,
+		method: method,
+		path:   path,
+		header: make(http.Header),
+		query:  make(url.Values),
+	}
+}
+
+// GET 请求
+func (t *Tester) GET(path string) *Request { return t.Request(http.MethodGet, path) }
+
+// POST 请求
+func (t *Tester) POST(path string) *Request { return t.Request(http.MethodPost, path) }
+
+// PUT 请求
+func (t *Tester) PUT(path string) *Request { return t.Request(http.MethodPut, path) }
+
+// DELETE 请求
+func (t *Tester) DELETE(path string) *Request { return t.Request(http.MethodDelete, path) }
+
+// WithHeader 设置请求头
+func (r *Request) WithHeader(key string, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// WithHost 设置请求的host
+func (r *Request) WithHost(host string) *Request {
+	r.host = host
+	return r
+}
+
+// WithQuery 加一个query参数
+func (r *Request) WithQuery(key string, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// WithBody 设置原始的请求体
+func (r *Request) WithBody(body []byte) *Request {
+	r.body = bytes.NewReader(body)
+	return r
+}
+
+// WithJSON 把v编码成json作为请求体
+func (r *Request) WithJSON(v interface{}) *Request {
+	data, err := json.Marshal(v)
+	if err != nil {
+		r.tester.t.Fatalf("peetest: encode json body: %v", err)
+	}
+	r.header.Set("Content-Type", "application/json")
+	return r.WithBody(data)
+}
+
+// WithForm 设置表单请求体
+func (r *Request) WithForm(form url.Values) *Request {
+	r.header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.body = strings.NewReader(form.Encode())
+	return r
+}
+
+// Expect 发出请求，返回可以断言的响应
+func (r *Request) Expect() *Response {
+	target := r.path
+	if len(r.query) > 0 {
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + r.query.Encode()
+	}
+	req := httptest.NewRequest(r.method, target, r.body)
+	for key, values := range r.header {
+		req.Header[key] = values
+	}
+	if r.host != "" {
+		req.Host = r.host
+	}
+	w := httptest.NewRecorder()
+	r.tester.handler.ServeHTTP(w, req)
+	return &Response{t: r.tester.t, Recorder: w}
+}
+
+// Response 测试请求的响应
+type Response struct {
+	t        testing.TB
+	Recorder *httptest.ResponseRecorder
+}
+
+// Status 断言状态码
+func (r *Response) Status(code int) *Response {
+	r.t.Helper()
+	if r.Recorder.Code != code {
+		r.t.Errorf("peetest: expect status %d, got %d", code, r.Recorder.Code)
+	}
+	return r
+}
+
+// Header 断言响应头
+func (r *Response) Header(key string, value string) *Response {
+	r.t.Helper()
+	if got := r.Recorder.Header().Get(key); got != value {
+		r.t.Errorf("peetest: expect header %s %q, got %q", key, value, got)
+	}
+	return r
+}
+
+// Body 断言响应体完全相等
+func (r *Response) Body(body string) *Response {
+	r.t.Helper()
+	if got := r.Recorder.Body.String(); got != body {
+		r.t.Errorf("peetest: expect body %q, got %q", body, got)
+	}
+	return r
+}
+
+// BodyContains 断言响应体包含s
+func (r *Response) BodyContains(s string) *Response {
+	r.t.Helper()
+	if got := r.Recorder.Body.String(); !strings.Contains(got, s) {
+		r.t.Errorf("peetest: expect body to contain %q, got %q", s, got)
+	}
+	return r
+}
+
+// JSON 断言响应体和want编码成的json等价，不要求字段顺序和空白一致
+func (r *Response) JSON(want interface{}) *Response {
+	r.t.Helper()
+	data, err := json.Marshal(want)
+	if err != nil {
+		r.t.Fatalf("peetest: encode expected json: %v", err)
+	}
+	var expected, got interface{}
+	_ = json.Unmarshal(data, &expected)
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), &got); err != nil {
+		r.t.Errorf("peetest: response is not json: %v, body %q", err, r.Recorder.Body.String())
+		return r
+	}
+	if !reflect.DeepEqual(expected, got) {
+		r.t.Errorf("peetest: expect json %s, got %s", data, strings.TrimSpace(r.Recorder.Body.String()))
+	}
+	return r
+}
+
+// DecodeJSON 把响应体解码到v，用于更复杂的断言
+func (r *Response) DecodeJSON(v interface{}) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), v); err != nil {
+		r.t.Errorf("peetest: decode json: %v, body %q", err, r.Recorder.Body.String())
+	}
+	return r
+}
+
+// NewContext 不启动服务创建上下文，用来单独测试一个中间件，例如
+//
+//	c, w := peetest.NewContext(req, middleware, handler)
+//	c.Next()
+func NewContext(req *http.Request, handlers ...pee.HandlerFunc) (*pee.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	return pee.CreateTestContext(w, req, handlers...), w
+}
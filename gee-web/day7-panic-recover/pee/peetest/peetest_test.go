@@ -0,0 +1,46 @@
+package peetest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"pee"
+	"testing"
+)
+
+type login struct {
+	Name string `json:"name"`
+}
+
+func TestTester(t *testing.T) {
+	r := pee.New()
+	r.POST("/login/:id", func(c *pee.Context) {
+		c.SetHeader("X-Id", c.Param("id"))
+		c.JSON(http.StatusOK, pee.H{"name": c.Query("name"), "id": c.Param("id")})
+	})
+
+	New(t, r).POST("/login/7").
+		WithQuery("name", "lzj").
+		WithJSON(login{Name: "lzj"}).
+		Expect().
+		Status(http.StatusOK).
+		Header("X-Id", "7").
+		JSON(pee.H{"id": "7", "name": "lzj"})
+
+	New(t, r).GET("/missing").Expect().Status(http.StatusNotFound).BodyContains("404")
+}
+
+func TestNewContext(t *testing.T) {
+	auth := func(c *pee.Context) {
+		if c.Req.Header.Get("Authorization") == "" {
+			c.Fail(http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		c.Next()
+	}
+	called := false
+	c, w := NewContext(httptest.NewRequest("GET", "/", nil), auth, func(c *pee.Context) { called = true })
+	c.Next()
+	if w.Code != http.StatusUnauthorized || called {
+		t.Fatalf("expect auth to stop the chain, got %d, called %v", w.Code, called)
+	}
+}
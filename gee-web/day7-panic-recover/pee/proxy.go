@@ -0,0 +1,276 @@
+package pee
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LoadBalance 代理选择后端的方式
+type LoadBalance int
+
+const (
+	RoundRobin LoadBalance = iota // 轮询
+	LeastConn                     // 最少连接
+)
+
+// ProxyConfig 反向代理的配置
+type ProxyConfig struct {
+	Targets     []string            // 后端地址，例如 http://10.0.0.1:8080
+	Balance     LoadBalance         // 负载均衡方式
+	Retries     int                 // 幂等请求失败后最多换几个后端重试，默认 len(Targets)-1，小于0时不重试
+	RetryBody   int64               // 重试要缓存请求体，最多缓存多少字节，超过时只转发一次不重试，默认1MB
+	MaxFails    int                 // 连续失败多少次后暂时摘除后端，默认3
+	FailTimeout time.Duration       // 摘除多久，默认10秒
+	Rewrite     func(string) string // 转发前改写路径
+	Headers     map[string]string   // 转发时注入的请求头
+	Transport   http.RoundTripper   // 默认 http.DefaultTransport
+}
+
+// RewritePrefix 把路径前缀 old 换成 new，可以作为 ProxyConfig.Rewrite
+func RewritePrefix(old string, new string) func(string) string {
+	return func(p string) string {
+		if !strings.HasPrefix(p, old) {
+			return p
+		}
+		p = new + strings.TrimPrefix(p, old)
+		if !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+		return p
+	}
+}
+
+// proxyTarget 一个后端
+type proxyTarget struct {
+	url       *url.URL
+	proxy     *httputil.ReverseProxy
+	active    int64 // 正在处理的请求数
+	fails     int   // 连续失败次数
+	downUntil time.Time
+}
+
+// reverseProxy 代理的运行状态
+type reverseProxy struct {
+	conf    ProxyConfig
+	mu      sync.Mutex
+	targets []*proxyTarget
+	next    uint64
+}
+
+type proxyErrorKey struct{}
+
+// Proxy 把请求轮询转发给 targets，地址不合法时 panic
+func Proxy(targets ...string) HandlerFunc {
+	return ProxyWithConfig(ProxyConfig{Targets: targets})
+}
+
+// ProxyWithConfig 基于 httputil.ReverseProxy 的反向代理，支持负载均衡、被动健康检查、
+// 幂等请求重试、路径改写、请求头注入和 WebSocket 转发，地址不合法时 panic
+func ProxyWithConfig(conf ProxyConfig) HandlerFunc {
+	if len(conf.Targets) == 0 {
+		panic("pee: proxy needs at least one target")
+	}
+	if conf.Retries == 0 {
+		conf.Retries = len(conf.Targets) - 1
+	}
+	if conf.RetryBody <= 0 {
+		conf.RetryBody = 1 << 20
+	}
+	if conf.MaxFails == 0 {
+		conf.MaxFails = 3
+	}
+	if conf.FailTimeout == 0 {
+		conf.FailTimeout = 10 * time.Second
+	}
+	p := &reverseProxy{conf: conf}
+	for _, target := range conf.Targets {
+		u, err := url.Parse(target)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			panic(fmt.Sprintf("pee: invalid proxy target %q", target))
+		}
+		rp := httputil.NewSingleHostReverseProxy(u)
+		rp.Transport = conf.Transport
+		// 出错时不直接写响应，记下错误交给外面决定是否重试
+		rp.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+			if holder, ok := req.Context().Value(proxyErrorKey{}).(*error); ok {
+				*holder = err
+			}
+		}
+		p.targets = append(p.targets, &proxyTarget{url: u, proxy: rp})
+	}
+	return p.handle
+}
+
+// 选择一个后端，优先选健康的、这次请求还没试过的
+func (p *reverseProxy) pick(tried map[*proxyTarget]bool) *proxyTarget {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	var candidates []*proxyTarget
+	for _, pass := range []func(t *proxyTarget) bool{
+		func(t *proxyTarget) bool { return !tried[t] && now.After(t.downUntil) },
+		func(t *proxyTarget) bool { return now.After(t.downUntil) },
+		func(t *proxyTarget) bool { return true }, // 全都不健康时还是要试一下
+	} {
+		for _, t := range p.targets {
+			if pass(t) {
+				candidates = append(candidates, t)
+			}
+		}
+		if len(candidates) > 0 {
+			break
+		}
+	}
+	if p.conf.Balance == LeastConn {
+		best := candidates[0]
+		for _, t := range candidates[1:] {
+			if atomic.LoadInt64(&t.active) < atomic.LoadInt64(&best.active) {
+				best = t
+			}
+		}
+		return best
+	}
+	p.next++
+	return candidates[(p.next-1)%uint64(len(candidates))]
+}
+
+// 被动健康检查，连续失败 MaxFails 次后摘除 FailTimeout
+func (p *reverseProxy) report(t *proxyTarget, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		t.fails = 0
+		return
+	}
+	t.fails++
+	if t.fails >= p.conf.MaxFails {
+		t.fails = 0
+		t.downUntil = time.Now().Add(p.conf.FailTimeout)
+	}
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func (p *reverseProxy) handle(c *Context) {
+	retries := p.conf.Retries
+	if !idempotent(c.Method) || retries < 0 {
+		retries = 0
+	}
+	// 重试时要重新发送请求体，所以先读出来，最多读 RetryBody 个字节
+	var body []byte
+	var rest io.Reader // 请求体太大时没读完的部分，这时只转发一次
+	if retries > 0 && c.Req.Body != nil && c.Req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(io.LimitReader(c.Req.Body, p.conf.RetryBody+1)); err != nil {
+			c.Fail(http.StatusBadRequest, "pee: read request body: "+err.Error())
+			return
+		}
+		if int64(len(body)) > p.conf.RetryBody {
+			rest, retries = c.Req.Body, 0
+		}
+	}
+
+	tried := make(map[*proxyTarget]bool)
+	for attempt := 0; ; attempt++ {
+		t := p.pick(tried)
+		tried[t] = true
+
+		var proxyErr error
+		out := c.Req.Clone(context.WithValue(c.Req.Context(), proxyErrorKey{}, &proxyErr))
+		switch {
+		case rest != nil:
+			out.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), rest), c.Req.Body}
+		case body != nil:
+			out.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		if p.conf.Rewrite != nil {
+			out.URL.Path = p.conf.Rewrite(out.URL.Path)
+			out.URL.RawPath = ""
+		}
+		out.Header.Set("X-Forwarded-Host", c.Req.Host)
+		if out.Header.Get("X-Forwarded-Proto") == "" {
+			proto := "http"
+			if c.Req.TLS != nil {
+				proto = "https"
+			}
+			out.Header.Set("X-Forwarded-Proto", proto)
+		}
+		for k, v := range p.conf.Headers {
+			out.Header.Set(k, v)
+		}
+
+		w := &proxyWriter{ResponseWriter: c.Writer}
+		atomic.AddInt64(&t.active, 1)
+		t.proxy.ServeHTTP(w, out)
+		atomic.AddInt64(&t.active, -1)
+		p.report(t, proxyErr)
+
+		if proxyErr == nil || errors.Is(proxyErr, context.Canceled) {
+			c.StatusCode = w.status
+			return
+		}
+		if w.wrote || attempt >= retries {
+			if !w.wrote {
+				c.String(http.StatusBadGateway, "502 Bad Gateway\n")
+			}
+			return
+		}
+	}
+}
+
+// proxyWriter 记录是否已经开始写响应，已经写了就不能再重试
+type proxyWriter struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (w *proxyWriter) WriteHeader(code int) {
+	w.status, w.wrote = code, true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *proxyWriter) Write(data []byte) (int, error) {
+	if !w.wrote {
+		w.status, w.wrote = http.StatusOK, true
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush 流式响应需要
+func (w *proxyWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack WebSocket 等协议升级需要接管连接
+func (w *proxyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("pee: response writer does not support hijacking")
+	}
+	w.status, w.wrote = http.StatusSwitchingProtocols, true
+	return h.Hijack()
+}
@@ -0,0 +1,122 @@
+package pee
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProxy(t *testing.T) {
+	backend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, _ := io.ReadAll(req.Body)
+			w.Write([]byte(name + " " + req.URL.Path + " " + req.Header.Get("X-Gateway") + " " + string(body)))
+		}))
+	}
+	a, b := backend("a"), backend("b")
+	defer a.Close()
+	defer b.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	r := New()
+	r.Any("/api/*path", ProxyWithConfig(ProxyConfig{
+		Targets: []string{a.URL, dead.URL, b.URL},
+		Rewrite: RewritePrefix("/api", ""),
+		Headers: map[string]string{"X-Gateway": "pee"},
+	}))
+
+	seen := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		w := serve(r, httptest.NewRequest("PUT", "/api/users", strings.NewReader("body")))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expect 200, got %d %q", w.Code, w.Body.String())
+		}
+		name, rest, _ := strings.Cut(w.Body.String(), " ")
+		if rest != "/users pee body" {
+			t.Fatalf("unexpected proxied request %q", w.Body.String())
+		}
+		seen[name]++
+	}
+	if seen["a"] == 0 || seen["b"] == 0 {
+		t.Fatalf("expect requests to be balanced, got %v", seen)
+	}
+
+	// POST 不是幂等的，转发到坏掉的后端时不重试
+	r.POST("/only-dead", Proxy(dead.URL))
+	if w := serve(r, httptest.NewRequest("POST", "/only-dead", nil)); w.Code != http.StatusBadGateway {
+		t.Fatalf("expect 502, got %d", w.Code)
+	}
+}
+
+func TestProxyRetryBody(t *testing.T) {
+	a := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		w.Write(body)
+	}))
+	defer a.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	r := New()
+	r.Handle("PUT", "/", ProxyWithConfig(ProxyConfig{Targets: []string{a.URL, dead.URL}, RetryBody: 4}))
+	codes := make(map[int]int)
+	for i := 0; i < 4; i++ {
+		// 小的请求体缓存下来，坏掉的后端换一个重试
+		if w := serve(r, httptest.NewRequest("PUT", "/", strings.NewReader("abc"))); w.Code != http.StatusOK || w.Body.String() != "abc" {
+			t.Fatalf("expect retry with small body, got %d %q", w.Code, w.Body.String())
+		}
+		// 超过 RetryBody 的请求体完整转发一次，不重试
+		w := serve(r, httptest.NewRequest("PUT", "/", strings.NewReader("0123456789")))
+		if w.Code == http.StatusOK && w.Body.String() != "0123456789" {
+			t.Fatalf("expect the whole body to be streamed, got %q", w.Body.String())
+		}
+		codes[w.Code]++
+	}
+	if codes[http.StatusOK] == 0 || codes[http.StatusBadGateway] == 0 {
+		t.Fatalf("expect large bodies not to be retried, got %v", codes)
+	}
+}
+
+func TestProxyUpgrade(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		buf.Flush()
+		line, _ := buf.ReadString('\n')
+		conn.Write([]byte("echo " + line))
+	}))
+	defer backend.Close()
+
+	m := NewMetrics()
+	r := New()
+	r.Use(m.Middleware())
+	r.GET("/ws", Proxy(backend.URL))
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: pee\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expect 101, got %v %v", resp, err)
+	}
+	conn.Write([]byte("hello\n"))
+	if line, _ := reader.ReadString('\n'); line != "echo hello\n" {
+		t.Fatalf("unexpected upgraded response %q", line)
+	}
+}
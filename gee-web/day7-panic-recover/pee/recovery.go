@@ -2,7 +2,6 @@ package pee
 
 import (
 	"fmt"
-	"log"
 	"net/http"
 	"runtime"
 	"strings"
@@ -27,7 +26,7 @@ func Recovery() HandlerFunc {
 		defer func() {
 			if err := recover(); err != nil {
 				message := fmt.Sprintf("%s", err)
-				log.Printf("%s\n\n", trace(message))
+				c.engine.logger.Printf("%s\n\n", trace(message))
 				c.Fail(http.StatusInternalServerError, "Internal Server Error")
 			}
 		}()
@@ -0,0 +1,179 @@
+package pee
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// Route 一条注册好的路由，可以给它起名字，之后通过名字反向生成 URL
+type Route struct {
+	Method   string
+	Pattern  string
+	Host     string // 为空时匹配所有host
+	handler  HandlerFunc
+	matchers []Matcher
+	engine   *Engine
+	// 名字和文档放在路由表的 meta 里，注册之后路由本身不再修改
+}
+
+// RouteInfo 路由的描述信息，Engine.Routes 返回
+type RouteInfo struct {
+	Method      string
+	Pattern     string
+	Host        string
+	Name        string
+	Handler     string // handler 的函数名
+	Middlewares int    // 命中这条路由时会执行的中间件数量
+}
+
+// Name 给路由命名，例如 r.GET("/users/:id", h).Name("user.show")。名字已经被别的路由用了时 panic
+func (r *Route) Name(name string) *Route {
+	r.engine.updateMeta(r, func(rt *router, m *routeMeta) {
+		if other, ok := rt.names[name]; ok && other != r {
+			panic(fmt.Sprintf("pee: route name %q is already used by %s %s", name, other.Method, other.Pattern))
+		}
+		if m.name != "" {
+			delete(rt.names, m.name)
+		}
+		m.name = name
+		rt.names[name] = r
+	})
+	return r
+}
+
+// 在新的路由表上修改路由的名字或文档，路由已经删除时什么都不做
+func (e *Engine) updateMeta(route *Route, fn func(rt *router, m *routeMeta)) {
+	e.updateRouter(func(old *router) *router {
+		m, ok := old.meta[route]
+		if !ok {
+			return old
+		}
+		rt := old.clone()
+		fn(rt, &m)
+		rt.meta[route] = m
+		return rt
+	})
+}
+
+// Remove 删除这条路由，服务运行时也可以调用，返回路由是否还在路由表里
+func (r *Route) Remove() bool {
+	var removed bool
+	r.engine.updateRouter(func(old *router) *router {
+		var rt *router
+		rt, removed = old.without(func(route *Route) bool { return route == r })
+		return rt
+	})
+	return removed
+}
+
+// RemoveRoute 删除所有 host 下这个请求方法和 pattern 的路由，返回是否删除了路由
+func (e *Engine) RemoveRoute(method string, pattern string) bool {
+	var removed bool
+	e.updateRouter(func(old *router) *router {
+		var rt *router
+		rt, removed = old.without(func(route *Route) bool {
+			return route.Method == method && route.Pattern == pattern
+		})
+		return rt
+	})
+	return removed
+}
+
+// nameOfFunction 通过反射拿到函数名
+func nameOfFunction(f interface{}) string {
+	v := reflect.ValueOf(f)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+	return runtime.FuncForPC(v.Pointer()).Name()
+}
+
+// buildURL 把参数填进 pattern，用不到的参数拼成 query string
+func (r *Route) buildURL(pairs ...interface{}) string {
+	values := make(map[string]string)
+	var keys []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		key := fmt.Sprint(pairs[i])
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = fmt.Sprint(pairs[i+1])
+	}
+
+	used := make(map[string]bool)
+	var b strings.Builder
+	for _, part := range parsePatten(r.Pattern) {
+		b.WriteByte('/')
+		switch part[0] {
+		case ':', '{':
+			name := paramName(part)
+			used[name] = true
+			b.WriteString(url.PathEscape(values[name]))
+		case '*':
+			// * 可以匹配多层路径，每一层单独转义
+			used[part[1:]] = true
+			segments := strings.Split(values[part[1:]], "/")
+			for i, s := range segments {
+				segments[i] = url.PathEscape(s)
+			}
+			b.WriteString(strings.Join(segments, "/"))
+		default:
+			b.WriteString(part)
+		}
+	}
+	path := b.String()
+	if path == "" {
+		path = "/"
+	}
+
+	query := url.Values{}
+	for _, key := range keys {
+		if !used[key] {
+			query.Set(key, values[key])
+		}
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path
+}
+
+// URL 根据路由名反向生成 URL，pairs 是 key, value 交替的参数，
+// 例如 r.URL("user.show", "id", 42) 得到 /users/42。找不到路由时返回空字符串。
+func (e *Engine) URL(name string, pairs ...interface{}) string {
+	route, ok := e.router.Load().names[name]
+	if !ok {
+		return ""
+	}
+	return route.buildURL(pairs...)
+}
+
+// Routes 按注册顺序返回所有路由的信息
+func (e *Engine) Routes() []RouteInfo {
+	rt := e.router.Load()
+	routes := rt.routes
+	e.groupsMu.RLock()
+	defer e.groupsMu.RUnlock()
+	infos := make([]RouteInfo, 0, len(routes))
+	for _, route := range routes {
+		// 和 ServeHTTP 一样，按分组前缀统计会执行的中间件
+		count := 0
+		for _, group := range e.groups {
+			if strings.HasPrefix(route.Pattern, group.prefix) && (group.host == nil || group.host.host == route.Host) {
+				count += len(group.middlewares)
+			}
+		}
+		infos = append(infos, RouteInfo{
+			Method:      route.Method,
+			Pattern:     route.Pattern,
+			Host:        route.Host,
+			Name:        rt.meta[route].name,
+			Handler:     nameOfFunction(route.handler),
+			Middlewares: count,
+		})
+	}
+	return infos
+}
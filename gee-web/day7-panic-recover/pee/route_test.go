@@ -0,0 +1,122 @@
+package pee
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func showUser(c *Context) {}
+
+func TestURL(t *testing.T) {
+	r := New()
+	r.GET("/users/:id", showUser).Name("user.show")
+	r.GET("/assets/*filepath", nil).Name("assets")
+	r.GET("/", nil).Name("index")
+	r.GET("/posts/{id:int}", nil).Name("post.show")
+
+	cases := []struct{ got, want string }{
+		{r.URL("user.show", "id", 42), "/users/42"},
+		{r.URL("user.show", "id", "a b", "tab", "info"), "/users/a%20b?tab=info"},
+		{r.URL("assets", "filepath", "css/pee.css"), "/assets/css/pee.css"},
+		{r.URL("index"), "/"},
+		{r.URL("post.show", "id", 7), "/posts/7"},
+		{r.URL("unknown"), ""},
+	}
+	for _, c := range cases {
+		if c.got != c.want {
+			t.Fatalf("expect %q, got %q", c.want, c.got)
+		}
+	}
+
+	// 重名的路由 panic，原来的路由不受影响
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expect panic on duplicate route name")
+			}
+		}()
+		r.GET("/people/:id", showUser).Name("user.show")
+	}()
+	if got := r.URL("user.show", "id", 1); got != "/users/1" {
+		t.Fatalf("expect name to stay on /users/:id, got %q", got)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	r := New()
+	r.Use(Logger())
+	v1 := r.Group("/v1")
+	v1.Use(Recovery())
+	v1.GET("/users/:id", showUser).Name("user.show")
+	r.POST("/login", nil)
+	r.POST("/login", showUser)
+
+	routes := r.Routes()
+	if len(routes) != 2 {
+		t.Fatalf("expect 2 routes, got %d", len(routes))
+	}
+	user := routes[0]
+	if user.Method != "GET" || user.Pattern != "/v1/users/:id" || user.Name != "user.show" || user.Middlewares != 2 {
+		t.Fatalf("unexpected route info %+v", user)
+	}
+	if !strings.HasSuffix(user.Handler, ".showUser") {
+		t.Fatalf("unexpected handler name %s", user.Handler)
+	}
+	if login := routes[1]; login.Middlewares != 1 || !strings.HasSuffix(login.Handler, ".showUser") {
+		t.Fatalf("re-registered route should be replaced, got %+v", login)
+	}
+}
+
+// 服务运行时修改路由的名字和文档，不能和读路由表的请求冲突，用 -race 运行
+func TestRouteMetaConcurrent(t *testing.T) {
+	r := New()
+	route := r.GET("/users/:id", showUser)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			route.Doc(RouteDoc{Summary: "查询用户"}).Name("user.show")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_, _ = r.OpenAPI(OpenAPIInfo{Title: "pee"})
+		_ = r.Routes()
+		_ = r.URL("user.show", "id", 1)
+	}
+	<-done
+
+	if name := r.Routes()[0].Name; name != "user.show" {
+		t.Fatalf("expect name user.show, got %q", name)
+	}
+	// 删除之后再设置名字不会把路由加回来
+	route.Remove()
+	if route.Name("gone"); r.URL("gone") != "" || len(r.Routes()) != 0 {
+		t.Fatal("expect removed route to stay removed")
+	}
+}
+
+func TestRegisterSnapshot(t *testing.T) {
+	r := New()
+	r.GET("/users/:id", showUser)
+	old := r.router.Load()
+	r.GET("/users/:id/posts", showUser)
+	if n, _ := old.getRouter("GET", "/users/1/posts"); n != nil {
+		t.Fatal("expect old router to be unchanged")
+	}
+	if n, _ := r.router.Load().getRouter("GET", "/users/1/posts"); n == nil {
+		t.Fatal("expect new route in current router")
+	}
+
+	// Mount 的路由一次加进路由表，而且不出现在文档里
+	before := r.router.Load()
+	r.Mount("/static", http.NotFoundHandler())
+	for _, route := range r.router.Load().routes[len(before.routes):] {
+		if !r.router.Load().meta[route].hidden {
+			t.Fatalf("expect mounted route %s %s to be hidden", route.Method, route.Pattern)
+		}
+	}
+	if got := len(r.router.Load().routes) - len(before.routes); got != 2*len(anyMethods) {
+		t.Fatalf("expect %d mounted routes, got %d", 2*len(anyMethods), got)
+	}
+}
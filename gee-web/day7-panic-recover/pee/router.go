@@ -1,6 +1,7 @@
 package pee
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 )
@@ -8,18 +9,87 @@ import (
 // 路由表结构体，roots存储请求方式Trie的根节点
 type router struct {
 	roots    map[string]*node
-	handlers map[string]HandlerFunc
+	handlers map[string][]*Route // 同一个pattern可以按header、query注册多个handler
+	hosts    []*hostPattern      // 注册过的host，精确的host排在通配的前面
+	routes   []*Route            // 按注册顺序保存的路由
+	names    map[string]*Route   // 命名路由
+
+	// 路由的名字和文档，路由表里的每条路由都有一项
+	meta map[*Route]routeMeta
+}
+
+// 路由注册之后还能修改的信息，跟着路由表一起拷贝，改的时候生成新的路由表
+type routeMeta struct {
+	name   string
+	doc    *RouteDoc // 接口文档，生成 OpenAPI 时使用
+	hidden bool      // 不出现在 OpenAPI 文档里
 }
 
-// roots key eg, roots['GET'] roots['POST']
+// roots key eg, roots['GET'] roots['POST'] roots['api.example.com GET']
 // handlers key eg, handlers['GET-/p/:lang/doc'], handlers['POST-/p/book']
 
 // 新建一个路由映射表
 func newRouter() *router {
 	return &router{
 		roots:    make(map[string]*node),
-		handlers: make(map[string]HandlerFunc),
+		handlers: make(map[string][]*Route),
+		names:    make(map[string]*Route),
+		meta:     make(map[*Route]routeMeta),
+	}
+}
+
+// 拷贝路由表，在拷贝上修改不会影响正在使用旧路由表的请求。
+// 树和 handlers 里的切片是共用的，add 修改它们之前会先拷贝
+func (r *router) clone() *router {
+	c := &router{
+		roots:    make(map[string]*node, len(r.roots)),
+		handlers: make(map[string][]*Route, len(r.handlers)),
+		hosts:    append([]*hostPattern(nil), r.hosts...),
+		routes:   append([]*Route(nil), r.routes...),
+		names:    make(map[string]*Route, len(r.names)),
+		meta:     make(map[*Route]routeMeta, len(r.meta)),
+	}
+	for key, root := range r.roots {
+		c.roots[key] = root
+	}
+	for key, routes := range r.handlers {
+		c.handlers[key] = routes
+	}
+	for name, route := range r.names {
+		c.names[name] = route
+	}
+	for route, m := range r.meta {
+		c.meta[route] = m
+	}
+	return c
+}
+
+// 去掉满足 remove 的路由，剩下的按原来的顺序重新加一遍，返回新的路由表
+func (r *router) without(remove func(*Route) bool) (*router, bool) {
+	c := newRouter()
+	removed := false
+	for _, route := range r.routes {
+		if remove(route) {
+			removed = true
+			continue
+		}
+		c.add(route)
+		if m, ok := r.meta[route]; ok {
+			c.meta[route] = m
+			if m.name != "" {
+				c.names[m.name] = route
+			}
+		}
+	}
+	return c, removed
+}
+
+// 树根的key，没有host的路由只用请求方法
+func rootKey(host string, method string) string {
+	if host == "" {
+		return method
 	}
+	return host + " " + method
 }
 
 // 只允许一个*
@@ -31,6 +101,7 @@ func parsePatten(pattern string) []string {
 	parts := make([]string, 0)
 	for _, item := range vs {
 		if item != "" {
+			item = normalizePart(item)
 			parts = append(parts, item)
 			if item[0] == '*' {
 				break
@@ -40,41 +111,148 @@ func parsePatten(pattern string) []string {
 	return parts
 }
 
+// 分割请求路径。请求路径是客户端的输入，不能当成 pattern，{x} 和 * 都按普通的字符处理
+func splitPath(path string) []string {
+	parts := make([]string, 0)
+	for _, item := range strings.Split(path, "/") {
+		if item != "" {
+			parts = append(parts, item)
+		}
+	}
+	return parts
+}
+
+// 把 {name} 转成 :name，{name:*} 转成 *name，带约束的 {name:int} 保持不变
+func normalizePart(part string) string {
+	if len(part) < 2 || part[0] != '{' || part[len(part)-1] != '}' {
+		return part
+	}
+	name, constraint, _ := strings.Cut(part[1:len(part)-1], ":")
+	switch constraint {
+	case "":
+		return ":" + name
+	case "*":
+		return "*" + name
+	}
+	return part
+}
+
+// 返回参数段的参数名，不是参数段时返回空字符串
+func paramName(part string) string {
+	switch part[0] {
+	case ':', '*':
+		return part[1:]
+	case '{':
+		name, _, _ := strings.Cut(part[1:len(part)-1], ":")
+		return name
+	}
+	return ""
+}
+
 // 把映射加入路由表，method是请求方法，pattern是路径，handler是路由表信息
-func (r *router) addRoute(method string, pattern string, handler HandlerFunc) {
-	parts := parsePatten(pattern)
+func (r *router) addRoute(method string, pattern string, handler HandlerFunc) *Route {
+	return r.add(&Route{Method: method, Pattern: pattern, handler: handler})
+}
+
+// 把路由加入路由表，带host的路由放在单独的树里
+func (r *router) add(route *Route) *Route {
+	parts := parsePatten(route.Pattern)
+	for _, part := range parts {
+		if _, err := compileConstraint(part); err != nil {
+			panic(fmt.Sprintf("pee: invalid constraint in %q: %v", route.Pattern, err))
+		}
+	}
 
-	key := method + "-" + pattern
-	_, ok := r.roots[method]
+	root := rootKey(route.Host, route.Method)
+	n, ok := r.roots[root]
 	if !ok {
 		// 如果没有这个方法对应的根，那就创建一个
-		r.roots[method] = &node{}
+		n = &node{}
+	}
+	// 然后插入该路径，只拷贝这棵树上改动的路径
+	r.roots[root] = n.insert(route.Pattern, parts, 0)
+	if route.Host != "" {
+		r.addHost(route.Host)
+	}
+
+	key := root + "-" + route.Pattern
+	// matcher 相同的路由重复注册时替换原来的路由
+	for i, old := range r.handlers[key] {
+		if old != route && sameMatchers(old.matchers, route.matchers) {
+			routes := append([]*Route(nil), r.handlers[key]...)
+			routes[i] = route
+			r.handlers[key] = routes
+			for j := range r.routes {
+				if r.routes[j] == old {
+					r.routes[j] = route
+				}
+			}
+			// 名字保留下来，文档跟着新的路由重新写
+			name := r.meta[old].name
+			delete(r.meta, old)
+			r.meta[route] = routeMeta{name: name}
+			if name != "" {
+				r.names[name] = route
+			}
+			return route
+		}
+	}
+	routes := r.handlers[key]
+	r.handlers[key] = append(routes[:len(routes):len(routes)], route)
+	r.routes = append(r.routes, route)
+	r.meta[route] = routeMeta{}
+	return route
+}
+
+// matcher 是函数，没法比较内容，同一个 Match 分组和它的子分组共用一个切片，用切片是否相同来判断
+func sameMatchers(a []Matcher, b []Matcher) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// 记录host，精确的host优先匹配
+func (r *router) addHost(host string) {
+	for _, h := range r.hosts {
+		if h.host == host {
+			return
+		}
 	}
-	// 然后插入该路径
-	r.roots[method].insert(pattern, parts, 0)
-	r.handlers[key] = handler
+	h := newHostPattern(host)
+	i := len(r.hosts)
+	if !h.wild {
+		for i > 0 && r.hosts[i-1].wild {
+			i--
+		}
+	}
+	r.hosts = append(r.hosts, nil)
+	copy(r.hosts[i+1:], r.hosts[i:])
+	r.hosts[i] = h
+}
+
+// 获取全部的路由，key是树根的key，没有host时就是请求方法
+func (r *router) getRouter(key string, path string) (*node, map[string]string) {
+	return r.searchRoute(key, path, nil)
 }
 
-// 获取全部的路由
-func (r *router) getRouter(method string, path string) (*node, map[string]string) {
-	searchParts := parsePatten(path) // 分割一下url
+// 和 getRouter 一样，找到的节点不满足 accept 时接着找其他能匹配的节点
+func (r *router) searchRoute(key string, path string, accept func(*node) bool) (*node, map[string]string) {
+	searchParts := splitPath(path) // 分割一下url
 	params := make(map[string]string)
-	root, ok := r.roots[method] // 获取当前请求方法的树根
+	root, ok := r.roots[key] // 获取当前请求方法的树根
 
 	if !ok {
 		return nil, nil
 	}
 
-	n := root.search(searchParts, 0) // 搜索对应的节点
+	n := root.searchFunc(searchParts, 0, accept) // 搜索对应的节点
 
 	if n != nil { // 如果找到对应的节点了
 		parts := parsePatten(n.pattern) // 获取剩下的待匹配路由
 		for i, part := range parts {
-			if part[0] == ':' { // 如果该段该匹配的路由有：
-				// 因为有冒号，所以什么都能匹配，直接把对应的映射上就好了
+			if part[0] == ':' || part[0] == '{' { // 如果该段该匹配的路由有：或者{}
+				// 因为有冒号，所以什么都能匹配，直接把对应的映射上就好了，{}的约束在搜索的时候已经检查过了
 				// 比如/hello/:name /hello/lzj
 				// 映射出来就是params[name] = lzj
-				params[part[1:]] = searchParts[i]
+				params[paramName(part)] = searchParts[i]
 			}
 			if part[0] == '*' && len(part) > 1 { // 同上
 				params[part[1:]] = strings.Join(searchParts[i:], "/")
@@ -86,16 +264,69 @@ func (r *router) getRouter(method string, path string) (*node, map[string]string
 	return nil, nil
 }
 
-// 解析路由映射表，然后给对应的handler方法传入当前ServeHTTP上下文
-func (r *router) handle(c *Context) {
-	// 先获取节点和路由
-	n, params := r.getRouter(c.Method, c.Path)
-	if n != nil {
+// 在某棵树上查找路由，再从同一个pattern的handler里挑出满足matcher的那个，
+// 都不满足时接着找树上其他能匹配的pattern
+func (r *router) matchRoute(key string, req *http.Request) (*Route, map[string]string) {
+	var matched *Route
+	n, params := r.searchRoute(key, req.URL.Path, func(n *node) bool {
+		matched = r.pick(r.handlers[key+"-"+n.pattern], req)
+		return matched != nil
+	})
+	if n == nil {
+		return nil, nil
+	}
+	return matched, params
+}
+
+// 优先选满足matcher的路由，没有时选没有matcher的路由
+func (r *router) pick(routes []*Route, req *http.Request) *Route {
+	var fallback *Route
+	for _, route := range routes {
+		if len(route.matchers) == 0 {
+			fallback = route
+		} else if route.match(req) {
+			return route
+		}
+	}
+	return fallback
+}
+
+// 先按host查找，host路由找不到时再用不区分host的路由，这时不带host的参数
+func (r *router) route(req *http.Request) (*Route, map[string]string) {
+	host := requestHost(req)
+	for _, h := range r.hosts {
+		hostParams, ok := h.match(host)
+		if !ok {
+			continue
+		}
+		if route, params := r.matchRoute(rootKey(h.host, req.Method), req); route != nil {
+			for k, v := range hostParams {
+				params[k] = v
+			}
+			return route, params
+		}
+	}
+	return r.matchRoute(req.Method, req)
+}
+
+// 把ServeHTTP找到的路由交给上下文执行，route 为nil时返回404
+func (r *router) handle(c *Context, route *Route, params map[string]string) {
+	if target, ok := c.engine.redirectURL(r, c.Req, route); ok {
+		c.handlers = append(c.handlers, func(c *Context) {
+			code := http.StatusPermanentRedirect // 308 不会把 POST 改成 GET
+			if c.Method == http.MethodGet || c.Method == http.MethodHead {
+				code = http.StatusMovedPermanently
+			}
+			c.Redirect(code, target)
+		})
+		c.Next()
+		return
+	}
+	if route != nil {
 		// 把获取到的路由映射绑定到上下文
 		c.Params = params
-		// 此时的key就是上下文中的请求方法和n的待匹配url
-		key := c.Method + "-" + n.pattern
-		c.handlers = append(c.handlers, r.handlers[key]) // 传过来的上下文里面有刚才配到的中间件
+		c.Pattern = route.Pattern
+		c.handlers = append(c.handlers, route.handler) // 传过来的上下文里面有刚才配到的中间件
 		// 然后加入路由请求的handler函数
 	} else {
 		// 否则把报错的handler加入进去，运行到这里的时候就会报错了
@@ -2,7 +2,11 @@ package pee
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -43,3 +47,121 @@ func TestGetRoute(t *testing.T) {
 
 	fmt.Printf("matched path: %s, params['name']: %s\n", n.pattern, ps["name"])
 }
+
+func TestTypedParams(t *testing.T) {
+	r := newRouter()
+	r.addRoute("GET", "/users/{id:int}", nil)
+	r.addRoute("GET", "/users/{name}", nil)
+	r.addRoute("GET", "/posts/{slug:[a-z-]+}", nil)
+	r.addRoute("GET", "/files/{path:*}", nil)
+
+	cases := []struct {
+		path, pattern, key, value string
+	}{
+		{"/users/42", "/users/{id:int}", "id", "42"},
+		{"/users/lzj", "/users/{name}", "name", "lzj"},
+		{"/posts/hello-pee", "/posts/{slug:[a-z-]+}", "slug", "hello-pee"},
+		{"/files/css/pee.css", "/files/{path:*}", "path", "css/pee.css"},
+	}
+	for _, c := range cases {
+		n, ps := r.getRouter("GET", c.path)
+		if n == nil || n.pattern != c.pattern || ps[c.key] != c.value {
+			t.Fatalf("%s should match %s with %s=%s", c.path, c.pattern, c.key, c.value)
+		}
+	}
+	if n, _ := r.getRouter("GET", "/posts/Hello_Pee"); n != nil {
+		t.Fatalf("/posts/Hello_Pee shouldn't match %s", n.pattern)
+	}
+}
+
+func TestRequestPathNotPattern(t *testing.T) {
+	r := newRouter()
+	r.addRoute("GET", "/files/docs/b", nil)
+	r.addRoute("GET", "/files/:name/b", nil)
+	// 请求路径里的 {a:*} 是普通的字符，不能把后面的 /b 截掉
+	n, ps := r.getRouter("GET", "/files/{a:*}/b")
+	if n == nil || n.pattern != "/files/:name/b" || ps["name"] != "{a:*}" {
+		t.Fatalf("expect /files/:name/b with name={a:*}, got %v %v", n, ps)
+	}
+	if n, _ := r.getRouter("GET", "/files/{x}"); n != nil {
+		t.Fatalf("/files/{x} shouldn't match %s", n.pattern)
+	}
+}
+
+func TestInvalidConstraint(t *testing.T) {
+	defer func() {
+		if err := recover(); err == nil || !strings.Contains(fmt.Sprint(err), `"/users/{id:[0-9}"`) {
+			t.Fatalf("expect panic naming the pattern, got %v", err)
+		}
+	}()
+	newRouter().addRoute("GET", "/users/{id:[0-9}", nil)
+}
+
+func TestParamInt(t *testing.T) {
+	c := &Context{Params: map[string]string{"id": "42", "name": "lzj"}}
+	if id, err := c.ParamInt("id"); err != nil || id != 42 {
+		t.Fatalf("expect 42, got %d, %v", id, err)
+	}
+	if _, err := c.ParamInt("name"); err == nil {
+		t.Fatal("expect an error for non-numeric param")
+	}
+}
+
+func TestDynamicRoutes(t *testing.T) {
+	r := New(WithMode(TestMode))
+	users := r.GET("/users/:id", func(c *Context) { c.String(http.StatusOK, "v1") }).Name("user.show")
+	r.GET("/ping", func(c *Context) { c.String(http.StatusOK, "pong") })
+
+	// 服务运行时并发增删路由
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if w := serve(r, httptest.NewRequest("GET", "/ping", nil)); w.Code != http.StatusOK {
+					t.Errorf("/ping should always be served, got %d", w.Code)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		pattern := fmt.Sprintf("/plugins/p%d", i)
+		r.GET(pattern, func(c *Context) { c.String(http.StatusOK, "plugin") })
+		if i%2 == 0 {
+			r.RemoveRoute("GET", pattern)
+		}
+	}
+	r.Group("/admin").Use(func(c *Context) { c.Next() })
+	close(stop)
+	wg.Wait()
+
+	if w := serve(r, httptest.NewRequest("GET", "/plugins/p1", nil)); w.Code != http.StatusOK {
+		t.Fatalf("expect added route, got %d", w.Code)
+	}
+	if w := serve(r, httptest.NewRequest("GET", "/plugins/p2", nil)); w.Code != http.StatusNotFound {
+		t.Fatalf("expect removed route, got %d", w.Code)
+	}
+
+	// 重新注册替换 handler，名字保留
+	r.GET("/users/:id", func(c *Context) { c.String(http.StatusOK, "v2") })
+	if body := serve(r, httptest.NewRequest("GET", "/users/1", nil)).Body.String(); body != "v2" {
+		t.Fatalf("expect replaced handler, got %q", body)
+	}
+	if url := r.URL("user.show", "id", 1); url != "/users/1" {
+		t.Fatalf("name should survive replacing, got %q", url)
+	}
+	if users.Remove() {
+		t.Fatal("replaced route is no longer in the table")
+	}
+	if !r.RemoveRoute("GET", "/users/:id") || r.URL("user.show", "id", 1) != "" {
+		t.Fatal("expect route and name to be removed")
+	}
+}
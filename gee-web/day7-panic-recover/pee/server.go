@@ -0,0 +1,215 @@
+package pee
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// h2c 服务器同时支持 HTTP/1.1 和不加密的 HTTP/2
+func (e *Engine) h2cServer(addr string) *http.Server {
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Server{Addr: addr, Handler: e, Protocols: &protocols}
+}
+
+// RunH2C 启动不加密的 HTTP/2 服务，用于服务网格里说 h2c 的 sidecar，HTTP/1.1 请求照样可以处理
+func (e *Engine) RunH2C(addr string) (err error) {
+	return e.h2cServer(addr).ListenAndServe()
+}
+
+// RunTLS 启动 HTTPS 服务，证书文件变化时自动重新加载，不用重启
+func (e *Engine) RunTLS(addr string, certFile string, keyFile string) (err error) {
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	reloader.Logger = e.logger
+	server := &http.Server{
+		Addr:    addr,
+		Handler: e,
+		TLSConfig: &tls.Config{
+			GetCertificate: reloader.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+		},
+	}
+	return server.ListenAndServeTLS("", "")
+}
+
+// RunTLSDev 用自签名证书启动 HTTPS 服务，只用于本地开发。
+// 证书保存在用户缓存目录的 pee-dev 下，过期之前会一直复用。
+// 不放在共用的临时目录，免得别的用户提前放好自己的证书和私钥
+func (e *Engine) RunTLSDev(addr string) (err error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(cacheDir, "pee-dev")
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if !certValid(certFile, keyFile) {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+		if err := GenerateSelfSignedCert(certFile, keyFile); err != nil {
+			return err
+		}
+		e.logger.Printf("pee: generated self-signed certificate %s", certFile)
+	}
+	return e.RunTLS(addr, certFile, keyFile)
+}
+
+// CertReloader 从磁盘加载证书，文件修改时间变化后自动重新加载
+type CertReloader struct {
+	Logger LogPrinter // 重新加载失败时打印日志，为 nil 时用 log.Default()，RunTLS 里是引擎的 logger
+
+	certFile string
+	keyFile  string
+	interval time.Duration // 最多多久检查一次文件
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// NewCertReloader 加载证书，证书不合法时返回错误
+func NewCertReloader(certFile string, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, interval: time.Second}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// 证书和私钥里较新的那个修改时间
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// Reload 立即重新加载证书
+func (r *CertReloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.modTime, r.checkedAt = &cert, modTime, time.Now()
+	return nil
+}
+
+func (r *CertReloader) logger() LogPrinter {
+	if r.Logger == nil {
+		return log.Default()
+	}
+	return r.Logger
+}
+
+// GetCertificate 可以作为 tls.Config.GetCertificate，重新加载失败时继续使用旧证书
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	cert, check := r.cert, time.Since(r.checkedAt) >= r.interval
+	if check {
+		r.checkedAt = time.Now()
+	}
+	modTime := r.modTime
+	r.mu.Unlock()
+
+	if check {
+		if latest, err := r.latestModTime(); err == nil && !latest.Equal(modTime) {
+			if err := r.Reload(); err != nil {
+				r.logger().Printf("pee: reload certificate %s: %v", r.certFile, err)
+			} else {
+				r.mu.Lock()
+				cert = r.cert
+				r.mu.Unlock()
+			}
+		}
+	}
+	return cert, nil
+}
+
+// GenerateSelfSignedCert 生成自签名证书，hosts 是证书里的域名或IP，默认 localhost、127.0.0.1、::1
+func GenerateSelfSignedCert(certFile string, keyFile string, hosts ...string) error {
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"pee development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  false, // 自签名的服务端证书，不是 CA
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+}
+
+// 证书存在、能加载并且一天之内不会过期
+func certValid(certFile string, keyFile string) bool {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return false
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return false
+	}
+	return time.Now().Add(24 * time.Hour).Before(leaf.NotAfter)
+}
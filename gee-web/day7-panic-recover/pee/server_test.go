@@ -0,0 +1,79 @@
+package pee
+
+import (
+	"bytes"
+	"crypto/x509"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := GenerateSelfSignedCert(certFile, keyFile, "pee.local"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.interval = 0
+	var logs bytes.Buffer
+	r.Logger = log.New(&logs, "", 0)
+	first, _ := r.GetCertificate(nil)
+	leaf, _ := x509.ParseCertificate(first.Certificate[0])
+	if leaf.DNSNames[0] != "pee.local" {
+		t.Fatalf("unexpected certificate names %v", leaf.DNSNames)
+	}
+
+	if err := GenerateSelfSignedCert(certFile, keyFile, "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, later, later)
+	second, _ := r.GetCertificate(nil)
+	if second == first {
+		t.Fatal("expect the certificate to be reloaded")
+	}
+
+	// 写坏的证书时继续用旧的
+	_ = os.WriteFile(certFile, []byte("broken"), 0o644)
+	later = later.Add(time.Minute)
+	_ = os.Chtimes(certFile, later, later)
+	if third, _ := r.GetCertificate(nil); third != second {
+		t.Fatal("expect the old certificate to be kept")
+	}
+	if !strings.Contains(logs.String(), "pee: reload certificate") {
+		t.Fatalf("expect the reload error on the reloader's logger, got %q", logs.String())
+	}
+}
+
+func TestH2C(t *testing.T) {
+	r := New()
+	r.GET("/", func(c *Context) { c.String(http.StatusOK, "%s", c.Req.Proto) })
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := r.h2cServer("")
+	go server.Serve(l)
+	defer server.Close()
+
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+	resp, err := client.Get("http://" + l.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("expect HTTP/2, got %s", resp.Proto)
+	}
+}
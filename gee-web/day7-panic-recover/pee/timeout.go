@@ -0,0 +1,126 @@
+package pee
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TimeoutConfig 超时中间件的配置
+type TimeoutConfig struct {
+	Timeout     time.Duration
+	StatusCode  int    // 超时后返回的状态码，默认503，也可以用504
+	Body        string // 超时后返回的内容
+	ContentType string
+}
+
+// timeoutWriter 先把handler的响应缓存起来，超时之后再写入的内容会被丢掉
+type timeoutWriter struct {
+	mu          sync.Mutex
+	header      http.Header
+	buf         bytes.Buffer
+	code        int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.code, tw.wroteHeader = http.StatusOK, true
+	}
+	return tw.buf.Write(data)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.code, tw.wroteHeader = code, true
+}
+
+// Timeout 给后面的handler加上超时，超时返回503
+func Timeout(timeout time.Duration) HandlerFunc {
+	return TimeoutWithConfig(TimeoutConfig{Timeout: timeout})
+}
+
+// TimeoutWithConfig 给后面的handler加上超时，handler 可以通过 c.Req.Context() 感知超时
+func TimeoutWithConfig(conf TimeoutConfig) HandlerFunc {
+	if conf.StatusCode == 0 {
+		conf.StatusCode = http.StatusServiceUnavailable
+	}
+	if conf.Body == "" {
+		conf.Body = http.StatusText(conf.StatusCode)
+	}
+	if conf.ContentType == "" {
+		conf.ContentType = "text/plain; charset=utf-8"
+	}
+	return func(c *Context) {
+		ctx, cancel := context.WithTimeout(c.Req.Context(), conf.Timeout)
+		defer cancel()
+
+		w := c.Writer
+		tw := &timeoutWriter{header: w.Header().Clone()}
+		// 后面的handler在上下文的副本上执行，超时返回之后不会和外层的Next抢index
+		cp := *c
+		cp.Writer = tw
+		cp.Req = c.Req.WithContext(ctx)
+		cp.Keys = make(map[string]interface{}, len(c.Keys))
+		for k, v := range c.Keys {
+			cp.Keys[k] = v
+		}
+
+		done := make(chan struct{})
+		panicChan := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicChan <- p
+				}
+			}()
+			cp.Next()
+			close(done)
+		}()
+
+		select {
+		case p := <-panicChan:
+			// 交给外层的 Recovery 处理
+			c.Abort()
+			panic(p)
+		case <-done:
+			c.Abort()
+			c.StatusCode = cp.StatusCode
+			c.Keys = cp.Keys
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			dst := w.Header()
+			for key, values := range tw.header {
+				dst[key] = values
+			}
+			if tw.wroteHeader {
+				w.WriteHeader(tw.code)
+			}
+			w.Write(tw.buf.Bytes())
+		case <-ctx.Done():
+			c.Abort()
+			tw.mu.Lock()
+			tw.timedOut = true
+			tw.mu.Unlock()
+			c.SetHeader("Content-Type", conf.ContentType)
+			c.Status(conf.StatusCode)
+			w.Write([]byte(conf.Body))
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package pee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	r := New()
+	r.Use(Recovery(), TimeoutWithConfig(TimeoutConfig{
+		Timeout:    50 * time.Millisecond,
+		StatusCode: http.StatusGatewayTimeout,
+		Body:       "too slow",
+	}))
+	r.GET("/fast", func(c *Context) {
+		c.SetHeader("X-Fast", "1")
+		c.String(http.StatusCreated, "fast")
+	})
+	late := make(chan error, 1)
+	r.GET("/slow", func(c *Context) {
+		<-c.Req.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		c.Status(http.StatusOK)
+		_, err := c.Writer.Write([]byte("late write"))
+		late <- err
+	})
+	r.GET("/panic", func(c *Context) {
+		panic("boom")
+	})
+
+	w := serve(r, httptest.NewRequest("GET", "/fast", nil))
+	if w.Code != http.StatusCreated || w.Body.String() != "fast" || w.Header().Get("X-Fast") != "1" {
+		t.Fatalf("unexpected fast response %d %q", w.Code, w.Body.String())
+	}
+	w = serve(r, httptest.NewRequest("GET", "/slow", nil))
+	if w.Code != http.StatusGatewayTimeout || w.Body.String() != "too slow" {
+		t.Fatalf("unexpected slow response %d %q", w.Code, w.Body.String())
+	}
+	// 等超时的handler写完，迟到的写入返回错误，不影响已经发出的响应
+	if err := <-late; err != http.ErrHandlerTimeout {
+		t.Fatalf("expect ErrHandlerTimeout for late write, got %v", err)
+	}
+	if w.Code != http.StatusGatewayTimeout || w.Body.String() != "too slow" {
+		t.Fatalf("late write changed the response to %d %q", w.Code, w.Body.String())
+	}
+	w = serve(r, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("panic should be recovered, got %d", w.Code)
+	}
+}
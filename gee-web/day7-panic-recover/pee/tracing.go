@@ -0,0 +1,196 @@
+package pee
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID W3C trace-context 里的 trace-id
+type TraceID [16]byte
+
+// SpanID W3C trace-context 里的 parent-id
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// IsValid 全0的 trace-id 是无效的
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// IsValid 全0的 span-id 是无效的
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext 需要在服务之间传递的追踪信息
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte   // 最低位表示是否采样
+	TraceState string // tracestate 原样传递
+}
+
+var errInvalidTraceparent = errors.New("pee: invalid traceparent")
+
+// ParseTraceparent 解析 traceparent 请求头，格式 00-<trace-id>-<parent-id>-<flags>
+func ParseTraceparent(header string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errInvalidTraceparent
+	}
+	// 版本 ff 是无效的，版本 00 只能有四段
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, errInvalidTraceparent
+	}
+	// 规范要求小写的十六进制
+	for _, part := range parts[:4] {
+		if strings.ToLower(part) != part {
+			return sc, errInvalidTraceparent
+		}
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, errInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, errInvalidTraceparent
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil || !sc.TraceID.IsValid() || !sc.SpanID.IsValid() {
+		return sc, errInvalidTraceparent
+	}
+	sc.Flags = byte(flags)
+	return sc, nil
+}
+
+// Traceparent 生成 traceparent 请求头
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// Span 一次请求的追踪记录
+type Span struct {
+	Name       string
+	Context    SpanContext
+	Parent     SpanID // 上游的span，没有时无效
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]string
+}
+
+// SpanExporter 导出结束的span，可以实现成发给 Jaeger、Zipkin 等
+type SpanExporter interface {
+	ExportSpan(span *Span)
+}
+
+// InMemoryExporter 把span保存在内存里，用于测试
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *InMemoryExporter) ExportSpan(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans 返回导出过的span
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset 清空保存的span
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+type spanContextKey struct{}
+
+const spanKey = "pee.span"
+
+// ContextWithSpan 把span放进 context.Context，用来传给 geerpc 调用或者 porm 的日志
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext 取出 ContextWithSpan 放进去的span，没有时返回nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// InjectTraceparent 把ctx里的追踪信息写入请求头，用于调用下游服务
+func InjectTraceparent(ctx context.Context, header http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	header.Set("traceparent", span.Context.Traceparent())
+	if span.Context.TraceState != "" {
+		header.Set("tracestate", span.Context.TraceState)
+	}
+}
+
+// Span 返回 Tracing 中间件创建的span，没有时返回nil
+func (c *Context) Span() *Span {
+	span, _ := c.Keys[spanKey].(*Span)
+	return span
+}
+
+// TraceID 返回这次请求的 trace-id，没有时返回空字符串
+func (c *Context) TraceID() string {
+	if span := c.Span(); span != nil {
+		return span.Context.TraceID.String()
+	}
+	return ""
+}
+
+// Tracing 追踪中间件，沿用上游的 traceparent 或者新建一条链路，每个请求创建一个以路由命名的span。
+// 上游没有采样（flags 最低位为 0）时照样传递追踪信息，但是不导出span
+func Tracing(exporter SpanExporter) HandlerFunc {
+	return func(c *Context) {
+		span := &Span{Start: time.Now(), Attributes: make(map[string]string)}
+		if parent, err := ParseTraceparent(c.Req.Header.Get("traceparent")); err == nil {
+			span.Context = parent
+			span.Parent = parent.SpanID
+			span.Context.TraceState = c.Req.Header.Get("tracestate")
+		} else {
+			_, _ = rand.Read(span.Context.TraceID[:])
+			span.Context.Flags = 1
+		}
+		_, _ = rand.Read(span.Context.SpanID[:])
+
+		route := c.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		span.Name = c.Method + " " + route
+		span.Attributes["http.method"] = c.Method
+		span.Attributes["http.route"] = route
+		span.Attributes["http.target"] = c.Req.URL.RequestURI()
+
+		c.Set(spanKey, span)
+		c.Req = c.Req.WithContext(ContextWithSpan(c.Req.Context(), span))
+		defer func() {
+			span.End = time.Now()
+			if c.StatusCode != 0 {
+				span.Attributes["http.status_code"] = strconv.Itoa(c.StatusCode)
+			}
+			if span.Context.Flags&1 == 1 {
+				exporter.ExportSpan(span)
+			}
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,88 @@
+package pee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(header)
+	if err != nil || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.Flags != 1 {
+		t.Fatalf("failed to parse traceparent: %+v, %v", sc, err)
+	}
+	if sc.Traceparent() != header {
+		t.Fatalf("expect %s, got %s", header, sc.Traceparent())
+	}
+	for _, bad := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+	} {
+		if _, err := ParseTraceparent(bad); err == nil {
+			t.Fatalf("expect an error for %q", bad)
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	r := New()
+	r.Use(Tracing(exporter))
+	var traceID string
+	r.GET("/users/:id", func(c *Context) {
+		traceID = c.TraceID()
+		if SpanFromContext(c.Req.Context()) != c.Span() {
+			t.Error("span should be reachable from the request context")
+		}
+		c.String(http.StatusOK, "ok")
+	})
+
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "pee=1")
+	serve(r, req)
+	serve(r, httptest.NewRequest("GET", "/users/2", nil))
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expect 2 spans, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "GET /users/:id" || span.Context.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		span.Parent.String() != "00f067aa0ba902b7" || span.Context.TraceState != "pee=1" ||
+		span.Attributes["http.status_code"] != "200" {
+		t.Fatalf("unexpected span %+v", span)
+	}
+	if spans[1].Parent.IsValid() || !spans[1].Context.TraceID.IsValid() || spans[1].Context.TraceID.String() != traceID {
+		t.Fatalf("expect a new root span, got %+v", spans[1])
+	}
+}
+
+func TestTracingNotSampled(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	r := New()
+	r.Use(Tracing(exporter))
+	var traceparent string
+	r.GET("/", func(c *Context) {
+		traceparent = c.Span().Context.Traceparent()
+		c.String(http.StatusOK, "ok")
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	serve(r, req)
+	if spans := exporter.Spans(); len(spans) != 0 {
+		t.Fatalf("expect unsampled span not to be exported, got %d", len(spans))
+	}
+	// 追踪信息还是要往下游传
+	if !strings.HasPrefix(traceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || !strings.HasSuffix(traceparent, "-00") {
+		t.Fatalf("expect trace to be propagated unsampled, got %s", traceparent)
+	}
+}
@@ -1,44 +1,87 @@
 package pee
 
-import "strings"
+import (
+	"regexp"
+	"strings"
+)
+
+// 内置的参数约束，{id:int} 里的 int 会被替换成对应的正则
+var paramTypes = map[string]string{
+	"int":   `-?[0-9]+`,
+	"uint":  `[0-9]+`,
+	"alpha": `[a-zA-Z]+`,
+	"alnum": `[a-zA-Z0-9]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
 
 type node struct {
-	pattern  string  // 待匹配路由，例如 /p/:lang
-	part     string  // 当前节点所占的路由一部分，比如:lang
-	children []*node // 当前节点的子节点，例如 [doc, tutorial, intro]
-	isWild   bool    // 是否精确匹配，part 含有 : 或 * 时为true，去匹配的时候如果是true不相等也可以匹配
+	pattern  string         // 待匹配路由，例如 /p/:lang
+	part     string         // 当前节点所占的路由一部分，比如:lang
+	children []*node        // 当前节点的子节点，例如 [doc, tutorial, intro]
+	isWild   bool           // 是否精确匹配，part 含有 : 或 * 或 { 时为true，去匹配的时候如果是true不相等也可以匹配
+	matcher  *regexp.Regexp // {name:constraint} 的约束，为nil时什么都能匹配
+}
+
+// 编译 {name:constraint} 里的约束，约束里不能有 /
+func compileConstraint(part string) (*regexp.Regexp, error) {
+	if part == "" || part[0] != '{' {
+		return nil, nil
+	}
+	_, constraint, _ := strings.Cut(part[1:len(part)-1], ":")
+	if expr, ok := paramTypes[constraint]; ok {
+		constraint = expr
+	}
+	return regexp.Compile("^(?:" + constraint + ")$")
+}
+
+// 当前节点能否匹配这一段路径
+func (n *node) matchPart(part string) bool {
+	if n.part == part {
+		return true
+	}
+	return n.isWild && (n.matcher == nil || n.matcher.MatchString(part))
 }
 
-// 插入
-func (n *node) insert(pattern string, parts []string, height int) {
+// 插入，不修改原来的树，只拷贝从根到新节点路径上的节点，返回拷贝出来的新节点
+func (n *node) insert(pattern string, parts []string, height int) *node {
+	c := *n
 	// 如果parts里面的后缀已经都插入了让他等于最后递归的后缀
 	if len(parts) == height {
 		// 比如/hello/:name，到2==2的时候hello.pattern就等于:name了，也就相当于:name是hello的子路由
-		n.pattern = pattern
-		return
+		c.pattern = pattern
+		return &c
 	}
 
 	// 获取第路径名
 	part := parts[height]
+	c.children = append([]*node(nil), n.children...)
 	// 匹配节点
-	child := n.matchChild(part)
+	i := n.matchChild(part)
 	// 如果匹配不到节点就创建一个
-	if child == nil {
+	if i < 0 {
 		// 保存该节点的路径信息，如果路径信息里有：或者*就设置精确匹配
-		child = &node{
-			part:   part,
-			isWild: part[0] == ':' || part[0] == '*',
-		}
-		// 把刚才创建的节点加入当前节点的子节点
-		n.children = append(n.children, child)
+		// 约束在 router.add 里已经检查过了
+		matcher, _ := compileConstraint(part)
+		c.children = append(c.children, &node{
+			part:    part,
+			isWild:  part[0] == ':' || part[0] == '*' || part[0] == '{',
+			matcher: matcher,
+		})
+		i = len(c.children) - 1
 	}
-	child.insert(pattern, parts, height+1)
+	c.children[i] = c.children[i].insert(pattern, parts, height+1)
+	return &c
 }
 
 func (n *node) search(parts []string, height int) *node {
+	return n.searchFunc(parts, height, nil)
+}
+
+// 和 search 一样，但是找到的节点还要满足 accept，不满足时接着找下一个候选节点，accept 为 nil 时不检查
+func (n *node) searchFunc(parts []string, height int, accept func(*node) bool) *node {
 	// 如果搜完了或者检测到*是前缀
 	if len(parts) == height || strings.HasPrefix(n.part, "*") {
-		if n.pattern == "" {
+		if n.pattern == "" || (accept != nil && !accept(n)) {
 			return nil
 		}
 		return n // 把上一个节点返回，因为是通过循环递归进来的，当前的函数执行就是上一个n
@@ -50,7 +93,7 @@ func (n *node) search(parts []string, height int) *node {
 	children := n.matchChildren(part) // 获取所有和该url取出来的待匹配路由匹配的
 
 	for _, child := range children { // 通过每个匹配到的路由往下搜
-		result := child.search(parts, height+1) // 直到搜到合适的路由节点
+		result := child.searchFunc(parts, height+1, accept) // 直到搜到合适的路由节点
 		if result != nil {
 			return result
 		}
@@ -58,21 +101,22 @@ func (n *node) search(parts []string, height int) *node {
 	return nil
 }
 
-// 第一个匹配成功的节点，用于插入
-func (n *node) matchChild(part string) *node {
-	for _, child := range n.children {
-		if child.part == part || child.isWild {
-			return child
+// 第一个匹配成功的节点的下标，用于插入，没有时返回 -1
+func (n *node) matchChild(part string) int {
+	for i, child := range n.children {
+		// 带约束的节点只和完全相同的段共用，不同约束的参数要分成不同的节点
+		if child.part == part || (child.isWild && child.matcher == nil && part[0] != '{') {
+			return i
 		}
 	}
-	return nil
+	return -1
 }
 
 // 所有匹配成功的，用来查找
 func (n *node) matchChildren(part string) []*node {
 	nodes := make([]*node, 0)
 	for _, child := range n.children {
-		if child.part == part || child.isWild { // 如果是：name，就直接匹配
+		if child.matchPart(part) { // 如果是：name，就直接匹配，{id:int}还要检查约束
 			nodes = append(nodes, child)
 		}
 	}
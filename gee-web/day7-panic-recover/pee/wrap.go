@@ -0,0 +1,85 @@
+package pee
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Any 注册时使用的所有请求方法
+var anyMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+	http.MethodHead, http.MethodOptions, http.MethodConnect, http.MethodTrace,
+}
+
+// WrapF 把 http.HandlerFunc 转成 pee 的 HandlerFunc
+func WrapF(f http.HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+		f(c.Writer, c.Req)
+	}
+}
+
+// WrapH 把 http.Handler 转成 pee 的 HandlerFunc
+func WrapH(h http.Handler) HandlerFunc {
+	return func(c *Context) {
+		h.ServeHTTP(c.Writer, c.Req)
+	}
+}
+
+// WrapMiddleware 把标准库风格的 func(http.Handler) http.Handler 中间件转成 pee 的中间件，
+// 标准中间件调用 next 时继续执行后面的 handlers，没有调用时中断
+func WrapMiddleware(mw func(http.Handler) http.Handler) HandlerFunc {
+	return func(c *Context) {
+		w, req := c.Writer, c.Req
+		defer func() { c.Writer, c.Req = w, req }()
+		called := false
+		next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			called = true
+			// 标准中间件可能换了 ResponseWriter 或者 Request，后面的 handler 要用新的
+			c.Writer, c.Req = w, req
+			c.Next()
+		})
+		mw(next).ServeHTTP(w, req)
+		if !called {
+			c.Abort()
+		}
+	}
+}
+
+// Handle 注册任意请求方法的路由
+func (g *RouterGroup) Handle(method string, pattern string, handler HandlerFunc) *Route {
+	return g.addRoute(method, pattern, handler)
+}
+
+// Any 给所有请求方法注册同一个handler
+func (g *RouterGroup) Any(pattern string, handler HandlerFunc) []*Route {
+	return g.engine.register(false, g.anyRoutes(pattern, handler)...)
+}
+
+// 所有请求方法的路由，还没有加进路由表
+func (g *RouterGroup) anyRoutes(pattern string, handler HandlerFunc) []*Route {
+	routes := make([]*Route, 0, len(anyMethods))
+	for _, method := range anyMethods {
+		routes = append(routes, g.newRoute(method, pattern, handler))
+	}
+	return routes
+}
+
+// Mount 把 http.Handler 挂到分组的 prefix 下，可以是 pprof、http.FileServer 或者另一个 pee.Engine。
+// 转发前去掉完整的前缀，分组的中间件照样执行
+func (g *RouterGroup) Mount(prefix string, handler http.Handler) {
+	relative := path.Join("/", prefix)
+	absolute := strings.TrimSuffix(g.prefix+relative, "/")
+	h := func(c *Context) {
+		http.StripPrefix(absolute, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "" {
+				req.URL.Path = "/"
+			}
+			handler.ServeHTTP(w, req)
+		})).ServeHTTP(c.Writer, c.Req)
+	}
+	routes := g.anyRoutes(relative, h)
+	routes = append(routes, g.anyRoutes(path.Join(relative, "/*filepath"), h)...)
+	// 挂载的 handler 自己的接口不出现在 OpenAPI 文档里
+	g.engine.register(true, routes...)
+}
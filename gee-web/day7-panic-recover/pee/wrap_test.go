@@ -0,0 +1,62 @@
+package pee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMount(t *testing.T) {
+	sub := New()
+	sub.GET("/users/:id", func(c *Context) { c.String(http.StatusOK, "user %s", c.Param("id")) })
+
+	r := New()
+	api := r.Group("/api")
+	api.Use(func(c *Context) {
+		c.SetHeader("X-Group", "api")
+		c.Next()
+	})
+	api.Mount("/v1", sub)
+	r.Mount("/std", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Method + " " + req.URL.Path))
+	}))
+
+	w := serve(r, httptest.NewRequest("GET", "/api/v1/users/7", nil))
+	if w.Body.String() != "user 7" || w.Header().Get("X-Group") != "api" {
+		t.Fatalf("unexpected mounted engine response %q, group header %q", w.Body.String(), w.Header().Get("X-Group"))
+	}
+	if body := serve(r, httptest.NewRequest("DELETE", "/std/a/b", nil)).Body.String(); body != "DELETE /a/b" {
+		t.Fatalf("unexpected mounted handler response %q", body)
+	}
+	if body := serve(r, httptest.NewRequest("GET", "/std", nil)).Body.String(); body != "GET /" {
+		t.Fatalf("unexpected mounted handler response %q", body)
+	}
+}
+
+func TestWrapMiddleware(t *testing.T) {
+	header := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("X-Std", "1")
+			next.ServeHTTP(w, req)
+		})
+	}
+	deny := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Query().Get("token") == "" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+	r := New()
+	r.Use(WrapMiddleware(header), WrapMiddleware(deny))
+	r.GET("/", WrapF(func(w http.ResponseWriter, req *http.Request) { w.Write([]byte("ok")) }))
+
+	if w := serve(r, httptest.NewRequest("GET", "/?token=1", nil)); w.Body.String() != "ok" || w.Header().Get("X-Std") != "1" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+	if w := serve(r, httptest.NewRequest("GET", "/", nil)); w.Code != http.StatusForbidden {
+		t.Fatalf("expect 403, got %d", w.Code)
+	}
+}
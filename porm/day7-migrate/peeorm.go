@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"peeorm/dialect"
@@ -128,6 +129,11 @@ func (engine *Engine) Close() {
 	log.Info("Close database success")
 }
 
+// 检查数据库连接是否可用，可以用作 pee 的健康检查
+func (engine *Engine) PingContext(ctx context.Context) error {
+	return engine.db.PingContext(ctx)
+}
+
 // 连接数据库，返回db指针，调用ping，是否正常连接。
 func (engine *Engine) NewSession() *session.Session {
 	return session.New(engine.db, engine.dialect)